@@ -0,0 +1,208 @@
+// Package agent implements a signing agent. The agent unlocks a secure vault
+// once and serves signature requests over a unix socket, so that node
+// processes never hold private keys themselves.
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/cb/vault"
+)
+
+// Config is the configuration of a signing agent.
+type Config struct {
+	Socket    string            // path of the unix socket
+	Vault     string            // path of the vault file, reopened on unlock
+	LockAfter time.Duration     // idle time before keys are dropped, zero never locks
+	Policies  map[string]Policy // policy of vault keys by label
+	Default   *Policy           // policy of other keys, nil refuses them
+}
+
+type agentKey struct {
+	key     crypto.PrivateKey
+	policy  *Policy
+	limiter *limiter
+}
+
+type Agent struct {
+	mu     sync.Mutex
+	config Config
+	owner  uint32
+	keys   map[crypto.Token]*agentKey
+	timer  *time.Timer
+}
+
+// Serve unlocks the agent with the keys of safe and serves requests on the
+// configured socket until the listener fails.
+func Serve(config Config, safe *vault.SecureVault) chan error {
+	finalize := make(chan error, 2)
+	if conn, err := net.Dial("unix", config.Socket); err == nil {
+		conn.Close()
+		finalize <- fmt.Errorf("agent already listening on %v", config.Socket)
+		return finalize
+	}
+	os.Remove(config.Socket)
+	listener, err := listen(config.Socket)
+	if err != nil {
+		finalize <- fmt.Errorf("could not listen on %v: %v", config.Socket, err)
+		return finalize
+	}
+	if err := os.Chmod(config.Socket, 0600); err != nil {
+		listener.Close()
+		finalize <- fmt.Errorf("could not restrict socket permissions: %v", err)
+		return finalize
+	}
+	agent := &Agent{config: config, owner: uint32(os.Getuid())}
+	agent.unlock(safe)
+	go func() {
+		defer os.Remove(config.Socket)
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				agent.lock()
+				finalize <- fmt.Errorf("agent listener failed: %v", err)
+				return
+			}
+			go agent.serve(conn)
+		}
+	}()
+	return finalize
+}
+
+// unlock loads every key of safe with a policy.
+func (a *Agent) unlock(safe *vault.SecureVault) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keys = make(map[crypto.Token]*agentKey)
+	for _, entry := range safe.Entries() {
+		policy := a.config.Default
+		if p, ok := a.config.Policies[entry.Label]; ok && entry.Label != "" {
+			policy = &p
+		}
+		if policy == nil {
+			continue
+		}
+		a.keys[entry.Token()] = &agentKey{key: entry.Key, policy: policy, limiter: &limiter{limit: policy.RateLimit}}
+	}
+	a.touch()
+}
+
+// lock drops every key held by the agent.
+func (a *Agent) lock() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, key := range a.keys {
+		key.key = crypto.PrivateKey{}
+	}
+	a.keys = nil
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+}
+
+// touch restarts the idle timer. Must be called with the lock held.
+func (a *Agent) touch() {
+	if a.config.LockAfter <= 0 {
+		return
+	}
+	if a.timer == nil {
+		a.timer = time.AfterFunc(a.config.LockAfter, func() {
+			a.lock()
+			log.Print("agent locked after idle timeout")
+		})
+		return
+	}
+	a.timer.Reset(a.config.LockAfter)
+}
+
+func (a *Agent) tokens() []crypto.Token {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	tokens := make([]crypto.Token, 0, len(a.keys))
+	for token := range a.keys {
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+func (a *Agent) sign(uid uint32, known bool, token crypto.Token, data []byte) (crypto.Signature, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.keys == nil {
+		return crypto.Signature{}, errors.New("agent is locked")
+	}
+	key, ok := a.keys[token]
+	if !ok {
+		return crypto.Signature{}, errors.New("key not available")
+	}
+	if !key.policy.allows(uid, known) {
+		return crypto.Signature{}, errors.New("caller not allowed")
+	}
+	if err := key.limiter.take(time.Now()); err != nil {
+		return crypto.Signature{}, err
+	}
+	a.touch()
+	return key.key.Sign(data), nil
+}
+
+func (a *Agent) serve(conn net.Conn) {
+	defer conn.Close()
+	uid, known := peerUID(conn)
+	for {
+		data, err := readMessage(conn)
+		if err != nil {
+			return
+		}
+		var reply []byte
+		switch data[0] {
+		case MsgKeys:
+			reply = KeyListReply(a.tokens())
+		case MsgSign:
+			token, msg, err := ParseSignRequest(data)
+			if err != nil {
+				reply = ErrorReply(err)
+			} else if signature, err := a.sign(uid, known, token, msg); err != nil {
+				reply = ErrorReply(err)
+			} else {
+				reply = SignatureReply(signature)
+			}
+		case MsgLock, MsgUnlock:
+			if !known || uid != a.owner {
+				reply = ErrorReply(errors.New("only the agent owner can lock or unlock it"))
+			} else if data[0] == MsgLock {
+				a.lock()
+				reply = OKReply()
+			} else if err := a.reopen(data); err != nil {
+				reply = ErrorReply(err)
+			} else {
+				reply = OKReply()
+			}
+		default:
+			reply = ErrorReply(errors.New("unknown request"))
+		}
+		if err := writeMessage(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (a *Agent) reopen(data []byte) error {
+	password, err := ParseUnlockRequest(data)
+	if err != nil {
+		return err
+	}
+	safe, err := vault.OpenSecureVault(password, a.config.Vault)
+	if err != nil {
+		return fmt.Errorf("could not open vault: %v", err)
+	}
+	defer safe.Close()
+	a.unlock(safe)
+	return nil
+}
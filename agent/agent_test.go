@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/cb/vault"
+)
+
+var testPassword = []byte("agent test passphrase")
+
+// newTestVault returns a vault with a "relay" and a "wallet" key.
+func newTestVault(t *testing.T) (*vault.SecureVault, string, crypto.Token, crypto.Token) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "vault.dat")
+	safe, err := vault.CreateSecureVault(testPassword, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay, _, err := safe.GenerateLabeledKey(vault.TypePrivateKey, "relay", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet, _, err := safe.GenerateLabeledKey(vault.TypePrivateKey, "wallet", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return safe, path, relay, wallet
+}
+
+func TestPolicyAllows(t *testing.T) {
+	tests := []struct {
+		name    string
+		callers []uint32
+		uid     uint32
+		known   bool
+		allowed bool
+	}{
+		{"any caller", nil, 1000, true, true},
+		{"any caller unknown peer", nil, 0, false, true},
+		{"listed caller", []uint32{1000, 1001}, 1001, true, true},
+		{"unlisted caller", []uint32{1000}, 1001, true, false},
+		{"unknown peer", []uint32{1000}, 1000, false, false},
+	}
+	for _, test := range tests {
+		policy := Policy{Callers: test.callers}
+		if got := policy.allows(test.uid, test.known); got != test.allowed {
+			t.Errorf("%v: allows returned %v", test.name, got)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := &limiter{limit: 2}
+	now := time.Now()
+	if l.take(now) != nil || l.take(now) != nil {
+		t.Fatal("signatures under the limit refused")
+	}
+	if l.take(now) == nil {
+		t.Fatal("signature over the limit accepted")
+	}
+	if err := l.take(now.Add(time.Minute)); err != nil {
+		t.Fatalf("limit not released after a minute: %v", err)
+	}
+}
+
+func TestPeerCredentialPolicy(t *testing.T) {
+	safe, path, relay, wallet := newTestVault(t)
+	uid := uint32(os.Getuid())
+	config := Config{
+		Socket:   filepath.Join(t.TempDir(), "agent.sock"),
+		Vault:    path,
+		Policies: map[string]Policy{"relay": {Callers: []uint32{uid + 1}}},
+		Default:  &Policy{Callers: []uint32{uid}},
+	}
+	finalize := Serve(config, safe)
+	safe.Close()
+	select {
+	case err := <-finalize:
+		t.Fatal(err)
+	default:
+	}
+	client, err := Dial(config.Socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	data := []byte("message")
+	signature, err := client.Sign(wallet, data)
+	if err != nil {
+		t.Fatalf("caller refused by default policy: %v", err)
+	}
+	if !wallet.Verify(data, signature) {
+		t.Error("invalid signature")
+	}
+	if _, err := client.Sign(relay, data); err == nil {
+		t.Error("caller not on the relay policy allowed to sign")
+	}
+}
+
+func TestLockAfterIdle(t *testing.T) {
+	safe, path, relay, _ := newTestVault(t)
+	defer safe.Close()
+	agent := &Agent{config: Config{Vault: path, LockAfter: 100 * time.Millisecond, Default: &Policy{}}}
+	agent.unlock(safe)
+	defer agent.lock()
+	for n := 0; n < 4; n++ {
+		time.Sleep(50 * time.Millisecond)
+		if _, err := agent.sign(0, false, relay, []byte("keep alive")); err != nil {
+			t.Fatalf("agent locked while in use: %v", err)
+		}
+	}
+	time.Sleep(250 * time.Millisecond)
+	if _, err := agent.sign(0, false, relay, []byte("idle")); err == nil {
+		t.Fatal("agent not locked after idle timeout")
+	}
+	agent.unlock(safe)
+	if _, err := agent.sign(0, false, relay, []byte("unlocked")); err != nil {
+		t.Fatalf("could not sign after unlock: %v", err)
+	}
+}
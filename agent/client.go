@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"net"
+	"sync"
+
+	"github.com/freehandle/breeze/crypto"
+)
+
+// Client is a connection to a signing agent.
+type Client struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func Dial(socket string) (*Client, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+func (c *Client) request(data []byte, expected byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := writeMessage(c.conn, data); err != nil {
+		return nil, err
+	}
+	reply, err := readMessage(c.conn)
+	if err != nil {
+		return nil, err
+	}
+	if err := replyError(reply, expected); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Keys returns the tokens of the keys the agent holds.
+func (c *Client) Keys() ([]crypto.Token, error) {
+	reply, err := c.request(KeysRequest(), MsgKeyList)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyListReply(reply)
+}
+
+// Sign asks the agent to sign data with the key associated to token.
+func (c *Client) Sign(token crypto.Token, data []byte) (crypto.Signature, error) {
+	reply, err := c.request(SignRequest(token, data), MsgSignature)
+	if err != nil {
+		return crypto.Signature{}, err
+	}
+	return ParseSignatureReply(reply)
+}
+
+// Lock makes the agent drop every key until it is unlocked again.
+func (c *Client) Lock() error {
+	_, err := c.request(LockRequest(), MsgOK)
+	return err
+}
+
+// Unlock makes the agent reopen its vault with password.
+func (c *Client) Unlock(password []byte) error {
+	_, err := c.request(UnlockRequest(password), MsgOK)
+	return err
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package agent
+
+import "net"
+
+// listen creates the unix socket. Without umask its permissions are only
+// restricted after it is created.
+func listen(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
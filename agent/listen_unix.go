@@ -0,0 +1,16 @@
+//go:build unix
+
+package agent
+
+import (
+	"net"
+	"syscall"
+)
+
+// listen creates the unix socket with no permissions for group and others,
+// so that it is never open to them before it is chmoded.
+func listen(path string) (net.Listener, error) {
+	mask := syscall.Umask(0177)
+	defer syscall.Umask(mask)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// Messages exchanged over the agent socket. Every message is prefixed by its
+// length as a little endian uint32.
+const (
+	MsgKeys byte = iota
+	MsgSign
+	MsgLock
+	MsgUnlock
+	MsgOK
+	MsgKeyList
+	MsgSignature
+	MsgError
+)
+
+// maxMessageSize bounds the data a client may ask the agent to sign.
+const maxMessageSize = 1 << 20
+
+func KeysRequest() []byte {
+	return []byte{MsgKeys}
+}
+
+func SignRequest(token crypto.Token, data []byte) []byte {
+	bytes := []byte{MsgSign}
+	util.PutToken(token, &bytes)
+	util.PutLargeByteArray(data, &bytes)
+	return bytes
+}
+
+func ParseSignRequest(data []byte) (crypto.Token, []byte, error) {
+	if len(data) < 1+crypto.Size || data[0] != MsgSign {
+		return crypto.Token{}, nil, errors.New("ParseSignRequest: invalid message")
+	}
+	token, position := util.ParseToken(data, 1)
+	msg, position := util.ParseLargeByteArray(data, position)
+	if position != len(data) {
+		return crypto.Token{}, nil, errors.New("ParseSignRequest: invalid message")
+	}
+	return token, msg, nil
+}
+
+func LockRequest() []byte {
+	return []byte{MsgLock}
+}
+
+func UnlockRequest(password []byte) []byte {
+	bytes := []byte{MsgUnlock}
+	util.PutByteArray(password, &bytes)
+	return bytes
+}
+
+func ParseUnlockRequest(data []byte) ([]byte, error) {
+	if len(data) < 1 || data[0] != MsgUnlock {
+		return nil, errors.New("ParseUnlockRequest: invalid message")
+	}
+	password, position := util.ParseByteArray(data, 1)
+	if position != len(data) {
+		return nil, errors.New("ParseUnlockRequest: invalid message")
+	}
+	return password, nil
+}
+
+func OKReply() []byte {
+	return []byte{MsgOK}
+}
+
+func KeyListReply(tokens []crypto.Token) []byte {
+	bytes := []byte{MsgKeyList}
+	util.PutTokenArray(tokens, &bytes)
+	return bytes
+}
+
+func ParseKeyListReply(data []byte) ([]crypto.Token, error) {
+	if len(data) < 1 || data[0] != MsgKeyList {
+		return nil, errors.New("ParseKeyListReply: invalid message")
+	}
+	tokens, position := util.ParseTokenArray(data, 1)
+	if position != len(data) {
+		return nil, errors.New("ParseKeyListReply: invalid message")
+	}
+	return tokens, nil
+}
+
+func SignatureReply(signature crypto.Signature) []byte {
+	bytes := []byte{MsgSignature}
+	util.PutSignature(signature, &bytes)
+	return bytes
+}
+
+func ParseSignatureReply(data []byte) (crypto.Signature, error) {
+	if len(data) != 1+len(crypto.Signature{}) || data[0] != MsgSignature {
+		return crypto.Signature{}, errors.New("ParseSignatureReply: invalid message")
+	}
+	signature, _ := util.ParseSignature(data, 1)
+	return signature, nil
+}
+
+func ErrorReply(err error) []byte {
+	bytes := []byte{MsgError}
+	util.PutString(err.Error(), &bytes)
+	return bytes
+}
+
+// replyError returns the error carried by an error reply, or an error if the
+// reply is not of the expected kind.
+func replyError(data []byte, expected byte) error {
+	if len(data) == 0 {
+		return errors.New("empty agent reply")
+	}
+	if data[0] == MsgError {
+		msg, _ := util.ParseString(data, 1)
+		return fmt.Errorf("agent: %v", msg)
+	}
+	if data[0] != expected {
+		return errors.New("unexpected agent reply")
+	}
+	return nil
+}
+
+func writeMessage(w io.Writer, data []byte) error {
+	bytes := make([]byte, 0, 4+len(data))
+	util.PutUint32(uint32(len(data)), &bytes)
+	_, err := w.Write(append(bytes, data...))
+	return err
+}
+
+func readMessage(r io.Reader) ([]byte, error) {
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(r, size); err != nil {
+		return nil, err
+	}
+	length, _ := util.ParseUint32(size, 0)
+	if length == 0 || length > maxMessageSize+64 {
+		return nil, fmt.Errorf("invalid message size %v", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,30 @@
+//go:build linux
+
+package agent
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerUID returns the user id of the process on the other end of a unix
+// socket connection.
+func peerUID(conn net.Conn) (uint32, bool) {
+	unix, ok := conn.(*net.UnixConn)
+	if !ok {
+		return 0, false
+	}
+	raw, err := unix.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil || credErr != nil {
+		return 0, false
+	}
+	return cred.Uid, true
+}
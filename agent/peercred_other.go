@@ -0,0 +1,11 @@
+//go:build !linux
+
+package agent
+
+import "net"
+
+// peerUID is only supported on linux. Elsewhere the caller is unknown and only
+// keys whose policy allows any caller can be used.
+func peerUID(conn net.Conn) (uint32, bool) {
+	return 0, false
+}
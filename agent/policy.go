@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"errors"
+	"time"
+)
+
+// Policy restricts the use of a vault key through the agent.
+type Policy struct {
+	Callers   []uint32 // user ids allowed to request signatures, empty allows any
+	RateLimit int      // maximum signatures per minute, zero is unlimited
+}
+
+func (p *Policy) allows(uid uint32, known bool) bool {
+	if len(p.Callers) == 0 {
+		return true
+	}
+	if !known {
+		return false
+	}
+	for _, caller := range p.Callers {
+		if caller == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// limiter counts the signatures of a key over the last minute.
+type limiter struct {
+	limit int
+	used  []time.Time
+}
+
+func (l *limiter) take(now time.Time) error {
+	if l.limit <= 0 {
+		return nil
+	}
+	recent := l.used[:0]
+	for _, t := range l.used {
+		if now.Sub(t) < time.Minute {
+			recent = append(recent, t)
+		}
+	}
+	l.used = recent
+	if len(l.used) >= l.limit {
+		return errors.New("rate limit exceeded")
+	}
+	l.used = append(l.used, now)
+	return nil
+}
@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"log"
+
+	"github.com/freehandle/breeze/crypto"
+)
+
+// RemoteKey signs with a key held by the agent. It satisfies social.Signer.
+type RemoteKey struct {
+	client *Client
+	token  crypto.Token
+}
+
+// Signer returns the agent key associated to token.
+func (c *Client) Signer(token crypto.Token) *RemoteKey {
+	return &RemoteKey{client: c, token: token}
+}
+
+func (r *RemoteKey) PublicKey() crypto.Token {
+	return r.token
+}
+
+// Sign returns an empty, and thus invalid, signature if the agent refuses to
+// sign or its signature does not match the token. Callers must verify the
+// signature before they publish it.
+func (r *RemoteKey) Sign(data []byte) crypto.Signature {
+	signature, err := r.client.Sign(r.token, data)
+	if err != nil {
+		log.Printf("could not sign with agent key %v: %v", r.token, err)
+		return crypto.Signature{}
+	}
+	if !r.token.Verify(data, signature) {
+		log.Printf("agent signature does not match key %v", r.token)
+		return crypto.Signature{}
+	}
+	return signature
+}
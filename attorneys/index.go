@@ -0,0 +1,88 @@
+package attorneys
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/freehandle/axe/attorney"
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+	"github.com/freehandle/cb/social"
+)
+
+// Index keeps the current powers of attorney granted on the axe protocol. It
+// is a social.Indexer: a validator node indexes every committed action and
+// answers queries with the attorneys of a token. The index is kept in memory
+// only. It is rebuilt as the node replays the blocks of its block provider, so
+// grants on blocks the provider no longer keeps are not known after a restart.
+type Index struct {
+	mu     sync.Mutex
+	grants map[crypto.Token]map[crypto.Token]struct{}
+}
+
+func NewIndex() *Index {
+	return &Index{grants: make(map[crypto.Token]map[crypto.Token]struct{})}
+}
+
+func (i *Index) Index(action []byte) {
+	if grant := attorney.ParseGrantPowerOfAttorney(action); grant != nil {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		attorneys, ok := i.grants[grant.Author]
+		if !ok {
+			attorneys = make(map[crypto.Token]struct{})
+			i.grants[grant.Author] = attorneys
+		}
+		attorneys[grant.Attorney] = struct{}{}
+		return
+	}
+	if revoke := attorney.ParseRevokePowerOfAttorney(action); revoke != nil {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		if attorneys, ok := i.grants[revoke.Author]; ok {
+			delete(attorneys, revoke.Attorney)
+			if len(attorneys) == 0 {
+				delete(i.grants, revoke.Author)
+			}
+		}
+	}
+}
+
+// Attorneys returns the tokens holding power of attorney for author.
+func (i *Index) Attorneys(author crypto.Token) []crypto.Token {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	tokens := make([]crypto.Token, 0, len(i.grants[author]))
+	for token := range i.grants[author] {
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// Query expects a token and responds with the array of its attorneys.
+func (i *Index) Query(request []byte) []byte {
+	if len(request) != len(crypto.Token{}) {
+		return nil
+	}
+	author, _ := util.ParseToken(request, 0)
+	response := make([]byte, 0)
+	util.PutTokenArray(i.Attorneys(author), &response)
+	return response
+}
+
+// RequestAttorneys asks the axe validator node at address for the attorneys
+// of author.
+func RequestAttorneys(address string, node crypto.Token, credentials crypto.PrivateKey, author crypto.Token) ([]crypto.Token, error) {
+	response, err := social.Query(address, node, credentials, author[:])
+	if err != nil {
+		return nil, err
+	}
+	if len(response) == 0 {
+		return nil, errors.New("node does not index powers of attorney")
+	}
+	tokens, position := util.ParseTokenArray(response, 0)
+	if position != len(response) {
+		return nil, errors.New("invalid attorneys response")
+	}
+	return tokens, nil
+}
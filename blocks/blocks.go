@@ -1,6 +1,8 @@
 package blocks
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 
@@ -8,6 +10,7 @@ import (
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/socket"
 	"github.com/freehandle/breeze/util"
+	"github.com/freehandle/cb/social"
 	"github.com/freehandle/papirus"
 )
 
@@ -121,22 +124,29 @@ func (b *BlockStore) Commit(epoch uint64, commit chain.BlockCommit) {
 	b.AppendBlock(&commited)
 }
 
-func NewBlockListener(config BlockListenerConfig, storage *BlockStore) chan error {
-
-	finalize := make(chan error, 2)
+// NewBlockListener keeps storage in sync with the blocks of a breeze node. It
+// does not listen, so its handle has no address.
+func NewBlockListener(ctx context.Context, config BlockListenerConfig, storage *BlockStore) (*social.Handle, error) {
 
 	conn, err := socket.Dial(config.NodeAddr, config.Credentials, config.NodeToken)
 	if err != nil {
-		finalize <- err
-		return finalize
+		return nil, err
 	}
+	handle := social.NewHandle(ctx)
+	go func() {
+		<-handle.Stopping()
+		conn.Shutdown()
+	}()
 	conn.Send([]byte{chain.MsgSyncRequest, 1, 0, 0, 0, 0, 0, 0, 0})
 	go func() {
 		for {
 			data, err := conn.Read()
 			if err != nil || len(data) == 0 {
-				fmt.Println(err)
-				finalize <- err
+				if err == nil {
+					err = errors.New("empty message from node")
+				}
+				handle.Fail(err)
+				handle.Stopped()
 				return
 			}
 			switch data[0] {
@@ -193,5 +203,5 @@ func NewBlockListener(config BlockListenerConfig, storage *BlockStore) chan erro
 			}
 		}
 	}()
-	return finalize
+	return handle, nil
 }
@@ -1,30 +1,63 @@
 package main
 
 import (
+	"context"
 	"encoding/hex"
+	"flag"
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/freehandle/axe/attorney"
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/socket"
+	"github.com/freehandle/cb/attorneys"
+	util "github.com/freehandle/cb/config"
 	"github.com/freehandle/cb/social"
 )
 
-var pkHex = "f622f274b13993e3f1824a30ef0f7e57f0c35a4fbdc38e54e37916ef06a64a797eb7aa3582b216bba42d45e91e0a560508478f5b55228439b42733945fd5c2f5"
-
+// axenode runs an axe validator node. Its key is derived from the secret key
+// of an existing vault, created with safe, on the axe/validator path.
 func main() {
-	var pk crypto.PrivateKey
-	bytesPk, _ := hex.DecodeString(pkHex)
-	copy(pk[:], bytesPk)
+	provider := flag.String("provider", "localhost:5005", "address of the block provider")
+	providerToken := flag.String("provider-token", "", "token of the block provider in hex")
+	port := flag.Int("port", 6000, "port served to block listeners")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: axenode [options] <vault-file>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	bytes, err := hex.DecodeString(*providerToken)
+	if err != nil || len(bytes) != crypto.Size {
+		log.Fatalf("invalid block provider token %q", *providerToken)
+	}
+	var token crypto.Token
+	copy(token[:], bytes)
+
+	secure, err := util.OpenExistingVault(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	pk, err := secure.DeriveKey("axe/validator")
+	secure.Close()
+	if err != nil {
+		log.Fatalf("could not derive node key: %v", err)
+	}
+	nodeToken := pk.PublicKey()
+	fmt.Printf("axe validator token %v\n", hex.EncodeToString(nodeToken[:]))
 
 	config := social.ProtocolValidatorNodeConfig{
-		BlockProviderAddr:  "localhost:5005",
-		BlockProviderToken: pk.PublicKey(),
-		Port:               6000,
+		BlockProviderAddr:  *provider,
+		BlockProviderToken: token,
+		Port:               *port,
 		NodeCredentials:    pk,
 		ValidateOutgoing:   socket.AcceptAllConnections,
 		KeepNBlocks:        1000,
+		Indexer:            attorneys.NewIndex(),
 	}
 
 	s := attorney.NewGenesisState("")
@@ -32,6 +65,22 @@ func main() {
 	if chain == nil {
 		log.Fatal("wrong")
 	}
-	err := <-social.LaunchNode[*attorney.Mutations, *attorney.MutatingState](config, chain)
-	fmt.Println(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	node, err := social.LaunchNode[*attorney.Mutations, *attorney.MutatingState](ctx, config, chain)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		shutdown := util.ShutdownEvents()
+		<-shutdown
+		log.Print("shutting down")
+		cancel()
+		<-shutdown
+		log.Print("forced shutdown")
+		os.Exit(1)
+	}()
+	if err := node.Wait(); err != nil {
+		log.Fatalf("axe validator stopped with error: %v", err)
+	}
+	log.Print("axe validator stopped")
 }
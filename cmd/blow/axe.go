@@ -1,49 +1,49 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"log"
 
 	"github.com/freehandle/axe/attorney"
-	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/socket"
+	"github.com/freehandle/cb/attorneys"
 	"github.com/freehandle/cb/social"
 	"github.com/freehandle/cb/topos"
 	"github.com/freehandle/papirus"
 )
 
-func AxeValidator(validator crypto.PrivateKey, source crypto.Token) chan error {
+func AxeValidator(ctx context.Context, topology *AxeValidatorTopology, keys Keyring) (*social.Handle, error) {
 	config := social.ProtocolValidatorNodeConfig{
-		BlockProviderAddr:  "localhost:5006",
-		BlockProviderToken: source,
-		Port:               6000,
-		NodeCredentials:    validator,
+		BlockProviderAddr:  topology.Breeze.Address,
+		BlockProviderToken: keys.Token(topology.Breeze),
+		Port:               topology.Port,
+		NodeCredentials:    keys.Key(topology.Key),
 		ValidateOutgoing:   socket.AcceptAllConnections,
-		KeepNBlocks:        100000,
+		KeepNBlocks:        topology.KeepBlocks,
+		Indexer:            attorneys.NewIndex(),
 	}
 	s := attorney.NewGenesisState("")
 	chain := social.NewSocialBlockChain[*attorney.Mutations, *attorney.MutatingState](s, 0)
 	if chain == nil {
 		log.Fatal("could not create axe protocol chain")
 	}
-	return social.LaunchNode[*attorney.Mutations, *attorney.MutatingState](config, chain)
+	return social.LaunchNode[*attorney.Mutations, *attorney.MutatingState](ctx, config, chain)
 }
 
-func AxeBlockProvider(provider crypto.PrivateKey, source crypto.Token) chan error {
-	finalize := make(chan error, 2)
-	storage := papirus.NewFileStore("blocks", 1<<22)
+func AxeBlockProvider(ctx context.Context, topology *AxeBlocksTopology, keys Keyring) (*social.Handle, error) {
+	storage := papirus.NewFileStore(topology.Path, 1<<22)
 	if storage == nil {
-		finalize <- fmt.Errorf("could not open block store")
-		return finalize
+		return nil, errors.New("could not open block store")
 	}
 	store := social.NewBlockStore(storage)
 	config := topos.BlockProviderConfig{
-		NodeAddress: "localhost:6000",
-		NodeToken:   source,
-		Credentials: provider,
-		ListenPort:  6001,
+		NodeAddress: topology.Validator.Address,
+		NodeToken:   keys.Token(topology.Validator),
+		Credentials: keys.Key(topology.Key),
+		ListenPort:  topology.Port,
 		Validate:    socket.AcceptAllConnections,
 		Store:       store,
 	}
-	return topos.BlockProviderNode(config)
+	return topos.BlockProviderNode(ctx, config)
 }
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freehandle/axe/attorney"
+	"github.com/freehandle/breeze/consensus/chain"
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/actions"
+	"github.com/freehandle/breeze/socket"
+	util "github.com/freehandle/cb/config"
+	"github.com/freehandle/cb/social"
+	"github.com/freehandle/cb/topos"
+)
+
+// Benchmark action kinds. Joins, grants and voids are axe actions dressed by
+// the benchmark wallet.
+const (
+	benchTransfer = "transfer"
+	benchJoin     = "join"
+	benchGrant    = "grant"
+	benchVoid     = "void"
+)
+
+// sample is a submitted action. Latencies are zero until observed.
+type sample struct {
+	kind      string
+	submitted time.Time
+	included  time.Duration     // on the relay
+	committed time.Duration     // on a social block of the validator
+	author    crypto.PrivateKey // author of a join
+}
+
+type benchmark struct {
+	mu        sync.Mutex
+	wallet    crypto.PrivateKey
+	fee       uint64
+	epoch     uint64
+	pending   map[crypto.Hash]*sample
+	samples   []*sample
+	authors   []crypto.PrivateKey // authors of joins seen committed
+	failed    int
+	lastSeen  time.Time
+	kinds     []string
+	weights   []int
+	weightSum int
+}
+
+// parseMix parses an action mix such as transfer=4,join=1 into kinds and
+// their weights.
+func parseMix(text string) ([]string, []int, error) {
+	kinds := make([]string, 0)
+	weights := make([]int, 0)
+	for _, item := range strings.Split(text, ",") {
+		kind, weight, found := strings.Cut(item, "=")
+		if !found {
+			weight = "1"
+		}
+		switch kind {
+		case benchTransfer, benchJoin, benchGrant, benchVoid:
+		default:
+			return nil, nil, fmt.Errorf("unknown action kind %q", kind)
+		}
+		value, err := strconv.Atoi(weight)
+		if err != nil || value < 0 {
+			return nil, nil, fmt.Errorf("invalid weight for %v", kind)
+		}
+		if value > 0 {
+			kinds = append(kinds, kind)
+			weights = append(weights, value)
+		}
+	}
+	if len(kinds) == 0 {
+		return nil, nil, errors.New("empty action mix")
+	}
+	return kinds, weights, nil
+}
+
+// bench submits a mix of actions to the first gateway of a running topology
+// and measures how long they take to be included on the first relay and to
+// be committed on a social block of the axe validator.
+func bench(args []string) {
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		fmt.Println("usage: blow bench <topology-file> [--wallet <label>] [options]")
+		os.Exit(2)
+	}
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	wallet := flags.String("wallet", "", "vault label of the funded wallet paying the actions, the first genesis wallet if empty")
+	mix := flags.String("mix", "transfer=4,join=1,grant=1,void=1", "action kinds and their weights")
+	rate := flags.Int("rate", 100, "actions submitted per second, unlimited if zero")
+	concurrency := flags.Int("concurrency", 4, "gateway connections submitting actions")
+	duration := flags.Duration("duration", 30*time.Second, "time submitting actions")
+	drain := flags.Duration("drain", 10*time.Second, "time waiting for pending actions after the last submit")
+	fee := flags.Uint64("fee", 1, "fee paid by each action")
+	flags.Parse(args[1:])
+	if *concurrency < 1 || *rate < 0 || flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	kinds, weights, err := parseMix(*mix)
+	if err != nil {
+		log.Fatalf("invalid mix: %v", err)
+	}
+
+	topology := ReadTopology(args[0])
+	if len(topology.Gateways) == 0 || len(topology.Relays) == 0 {
+		log.Fatal("bench needs a gateway and a relay on the topology")
+	}
+	for n := 0; *wallet == "" && n < len(topology.Genesis); n++ {
+		*wallet = topology.Genesis[n].Key
+	}
+	if *wallet == "" {
+		log.Fatal("bench needs a --wallet or a genesis wallet on the topology")
+	}
+	secure, err := util.OpenExistingVault(topology.Vault)
+	if err != nil {
+		log.Fatal(err)
+	}
+	keys := Keyring{vault: secure}
+	gateway := topology.Gateways[0]
+	gatewayAddress := fmt.Sprintf("localhost:%v", gateway.Port)
+	gatewayToken := keys.Key(gateway.Key).PublicKey()
+	relay := topology.Relays[0]
+	relayAddress := fmt.Sprintf("localhost:%v", relay.Port)
+	relayToken := keys.Key(relay.Key).PublicKey()
+
+	b := &benchmark{
+		wallet:  keys.Key(*wallet),
+		fee:     *fee,
+		pending: make(map[crypto.Hash]*sample),
+		kinds:   kinds,
+		weights: weights,
+	}
+	for _, weight := range weights {
+		b.weightSum += weight
+	}
+	_, credentials := crypto.RandomAsymetricKey()
+	balance, err := topos.RequestBalance(relayAddress, relayToken, credentials, b.wallet.PublicKey())
+	if err != nil {
+		log.Fatalf("could not get wallet balance from relay: %v", err)
+	}
+	b.epoch = balance.Epoch
+	fmt.Printf("wallet balance %v at epoch %v\n", balance.Wallet, balance.Epoch)
+
+	if err := b.watchRelay(relayAddress, relayToken, credentials); err != nil {
+		log.Fatalf("could not watch relay: %v", err)
+	}
+	if topology.AxeValidator != nil {
+		address := fmt.Sprintf("localhost:%v", topology.AxeValidator.Port)
+		b.watchValidator(address, keys.Key(topology.AxeValidator.Key).PublicKey(), credentials)
+	}
+
+	start := time.Now()
+	deadline := start.Add(*duration)
+	var ticks chan struct{}
+	if *rate > 0 {
+		ticks = make(chan struct{})
+		go func() {
+			ticker := time.NewTicker(time.Second / time.Duration(*rate))
+			defer ticker.Stop()
+			for time.Now().Before(deadline) {
+				<-ticker.C
+				select {
+				case ticks <- struct{}{}:
+				default: // workers behind, the action is not submitted
+				}
+			}
+			close(ticks)
+		}()
+	}
+	var workers sync.WaitGroup
+	for n := 0; n < *concurrency; n++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			b.submit(gatewayAddress, gatewayToken, ticks, deadline)
+		}()
+	}
+	workers.Wait()
+	elapsed := time.Since(start)
+	time.Sleep(*drain)
+	if b.report(elapsed, start) == 0 {
+		log.Fatal("no action was included on the relay")
+	}
+}
+
+// submit sends actions to the gateway until deadline, one for each tick if
+// ticks is not nil.
+func (b *benchmark) submit(address string, token crypto.Token, ticks chan struct{}, deadline time.Time) {
+	_, key := crypto.RandomAsymetricKey()
+	conn, err := socket.Dial(address, key, token)
+	if err != nil {
+		log.Printf("could not connect to gateway: %v", err)
+		return
+	}
+	defer conn.Shutdown()
+	for time.Now().Before(deadline) {
+		if ticks != nil {
+			if _, ok := <-ticks; !ok {
+				return
+			}
+		}
+		data := b.next()
+		if err := conn.Send(append([]byte{chain.MsgActionSubmit}, data...)); err != nil {
+			b.mu.Lock()
+			b.failed++
+			b.mu.Unlock()
+			log.Printf("could not submit action: %v", err)
+			return
+		}
+	}
+}
+
+// next builds an action of a random kind of the mix and registers it as
+// pending before it is submitted.
+func (b *benchmark) next() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pick := rand.Intn(b.weightSum)
+	kind := b.kinds[len(b.kinds)-1]
+	for n, weight := range b.weights {
+		if pick < weight {
+			kind = b.kinds[n]
+			break
+		}
+		pick -= weight
+	}
+	if (kind == benchGrant || kind == benchVoid) && len(b.authors) == 0 {
+		kind = benchJoin
+	}
+	var inner []byte
+	var joined crypto.PrivateKey
+	switch kind {
+	case benchTransfer:
+		to, _ := crypto.RandomAsymetricKey()
+		transfer := actions.Transfer{
+			TimeStamp: b.epoch,
+			From:      b.wallet.PublicKey(),
+			To:        []crypto.TokenValue{{Token: to, Value: 1}},
+			Reason:    "blow bench",
+			Fee:       b.fee,
+		}
+		transfer.Sign(b.wallet)
+		data := transfer.Serialize()
+		b.register(kind, data)
+		return data
+	case benchJoin:
+		_, joined = crypto.RandomAsymetricKey()
+		join := attorney.JoinNetwork{
+			Epoch:  b.epoch,
+			Author: joined.PublicKey(),
+			Handle: fmt.Sprintf("bench_%d_%d", time.Now().UnixNano(), len(b.samples)),
+		}
+		join.Sign(joined)
+		inner = join.Serialize()
+	case benchGrant:
+		author := b.authors[rand.Intn(len(b.authors))]
+		attorneyToken, _ := crypto.RandomAsymetricKey()
+		grant := attorney.GrantPowerOfAttorney{
+			Epoch:       b.epoch,
+			Author:      author.PublicKey(),
+			Attorney:    attorneyToken,
+			Fingerprint: make([]byte, 0),
+		}
+		grant.Sign(author)
+		inner = grant.Serialize()
+	case benchVoid:
+		author := b.authors[rand.Intn(len(b.authors))]
+		void := attorney.Void{
+			Epoch:  b.epoch,
+			Author: author.PublicKey(),
+			Data:   []byte("blow bench"),
+			Signer: author.PublicKey(),
+		}
+		void.Sign(author)
+		inner = void.Serialize()
+	}
+	data := actions.Dress(inner, b.wallet, b.fee)
+	s := b.register(kind, data)
+	s.author = joined
+	b.pending[crypto.Hasher(inner)] = s // social blocks may carry the axe action alone
+	return data
+}
+
+func (b *benchmark) register(kind string, data []byte) *sample {
+	s := &sample{kind: kind, submitted: time.Now()}
+	b.samples = append(b.samples, s)
+	b.pending[crypto.Hasher(data)] = s
+	return s
+}
+
+// observe records the latency of a pending action seen on the relay or on a
+// social block. Authors of committed joins can then grant and void.
+func (b *benchmark) observe(data []byte, commit bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.pending[crypto.Hasher(data)]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if commit && s.committed == 0 {
+		s.committed = now.Sub(s.submitted)
+		if s.kind == benchJoin {
+			b.authors = append(b.authors, s.author)
+		}
+	} else if !commit && s.included == 0 {
+		s.included = now.Sub(s.submitted)
+	}
+	b.lastSeen = now
+}
+
+// watchRelay follows new blocks and actions of the relay, keeping the epoch
+// of new actions current.
+func (b *benchmark) watchRelay(address string, token crypto.Token, credentials crypto.PrivateKey) error {
+	conn, err := socket.Dial(address, credentials, token)
+	if err != nil {
+		return err
+	}
+	if err := conn.Send(topos.NewSyncRequest(b.epoch)); err != nil {
+		conn.Shutdown()
+		return err
+	}
+	go func() {
+		defer conn.Shutdown()
+		for {
+			data, err := conn.Read()
+			if err != nil {
+				log.Printf("relay connection ended: %v", err)
+				return
+			}
+			if len(data) == 0 {
+				continue
+			}
+			switch data[0] {
+			case topos.MsgBlock:
+				if epoch, _, err := topos.ParseBlock(data); err == nil {
+					b.mu.Lock()
+					if epoch > b.epoch {
+						b.epoch = epoch
+					}
+					b.mu.Unlock()
+				}
+			case topos.MsgAction:
+				b.observe(data[1:], false)
+			}
+		}
+	}()
+	return nil
+}
+
+// watchValidator follows the social blocks committed by the axe validator.
+func (b *benchmark) watchValidator(address string, token crypto.Token, credentials crypto.PrivateKey) {
+	b.mu.Lock()
+	epoch := b.epoch
+	b.mu.Unlock()
+	blocks := social.SocialProtocolBlockListener(address, token, credentials, epoch)
+	go func() {
+		for block := range blocks {
+			if block == nil {
+				log.Print("validator connection ended")
+				return
+			}
+			for _, action := range block.Actions {
+				b.observe(action, true)
+			}
+		}
+	}()
+}
+
+// percentile is the nearest rank q percentile of sorted durations.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	rank := int(q*float64(len(sorted))+0.999999) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// report prints the benchmark results and returns the number of actions
+// included on the relay.
+func (b *benchmark) report(elapsed time.Duration, start time.Time) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	submitted := len(b.samples)
+	fmt.Printf("submitted %v actions in %v (%.1f/s), %v submit errors\n", submitted, elapsed.Round(time.Millisecond), float64(submitted)/elapsed.Seconds(), b.failed)
+	perKind := make(map[string]int)
+	for _, s := range b.samples {
+		perKind[s.kind]++
+	}
+	for _, kind := range b.kinds {
+		fmt.Printf("  %-10v %v\n", kind, perKind[kind])
+	}
+	window := b.lastSeen.Sub(start)
+	included := 0
+	for _, stage := range []string{"inclusion", "commit"} {
+		latencies := make([]time.Duration, 0)
+		for _, s := range b.samples {
+			latency := s.included
+			if stage == "commit" {
+				latency = s.committed
+			}
+			if latency > 0 {
+				latencies = append(latencies, latency)
+			}
+		}
+		if stage == "inclusion" {
+			included = len(latencies)
+		}
+		if len(latencies) == 0 {
+			fmt.Printf("%-10v none observed\n", stage)
+			continue
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		fmt.Printf("%-10v %v of %v observed, %.1f/s, p50 %v p90 %v p99 %v max %v\n",
+			stage, len(latencies), submitted, float64(len(latencies))/window.Seconds(),
+			percentile(latencies, 0.50).Round(time.Millisecond),
+			percentile(latencies, 0.90).Round(time.Millisecond),
+			percentile(latencies, 0.99).Round(time.Millisecond),
+			latencies[len(latencies)-1].Round(time.Millisecond))
+	}
+	return included
+}
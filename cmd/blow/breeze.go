@@ -1,24 +1,43 @@
 package main
 
 import (
+	"context"
 	"time"
 
 	"github.com/freehandle/breeze/consensus/poa"
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/socket"
+	"github.com/freehandle/cb/topos"
 )
 
-func breeze(pk crypto.PrivateKey) chan error {
+func breeze(topology *BreezeTopology, keys Keyring) chan error {
 
 	config := poa.SingleAuthorityConfig{
-		IncomingPort:     5005,
-		OutgoingPort:     5006,
+		IncomingPort:     topology.IncomingPort,
+		OutgoingPort:     topology.OutgoingPort,
 		BlockInterval:    time.Second,
 		ValidateIncoming: socket.AcceptAllConnections,
 		ValidateOutgoing: socket.AcceptAllConnections,
 		WalletFilePath:   "", // memory
-		KeepBlocks:       50,
-		Credentials:      pk,
+		KeepBlocks:       topology.KeepBlocks,
+		Credentials:      keys.Key(topology.Key),
 	}
 	return poa.Genesis(config)
 }
+
+func Authority(ctx context.Context, topology *AuthorityTopology, genesis map[crypto.Token]uint64, keys Keyring) (*topos.SingleAuthority, error) {
+	interval := time.Duration(topology.BlockInterval) * time.Millisecond
+	if interval == 0 {
+		interval = time.Second
+	}
+	config := topos.SingleAuthorityConfig{
+		IncomingPort:     topology.IncomingPort,
+		OutgoingPort:     topology.OutgoingPort,
+		Credentials:      keys.Key(topology.Key),
+		BlockInterval:    interval,
+		ValidateIncoming: socket.AcceptAllConnections,
+		ValidateOutgoing: socket.AcceptAllConnections,
+		KeepBlocks:       topology.KeepBlocks,
+	}
+	return topos.NewSingleAuthority(ctx, config, topos.NewWallets(0, genesis))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+
+	util "github.com/freehandle/cb/config"
+	"github.com/freehandle/cb/vault"
+)
+
+// devnet creates a local network of a single authority node, gateways and
+// relays in a new directory. Node keys are derived from the secret key of a
+// new vault, and the topology is written next to it. The authority keeps its
+// chain in memory only, so the topology can be run again with blow
+// <topology-file> once the relay chain files are removed.
+func devnet(args []string) (*Topology, Keyring) {
+	flags := flag.NewFlagSet("devnet", flag.ExitOnError)
+	relays := flags.Int("relays", 1, "number of relays")
+	gateways := flags.Int("gateways", 1, "number of gateways")
+	dir := flags.String("dir", "", "directory for the vault, topology and chain files, temporary if empty")
+	port := flags.Int("port", 0, "first of consecutive node ports, free ports if zero")
+	funds := flags.Uint64("funds", 1000000000, "genesis balance of the devnet wallet")
+	flags.Parse(args)
+	if flags.NArg() > 0 || *relays < 0 || *gateways < 0 || *port < 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if *dir == "" {
+		temp, err := os.MkdirTemp("", "blow-devnet-")
+		if err != nil {
+			log.Fatalf("could not create devnet directory: %v", err)
+		}
+		*dir = temp
+	} else if err := os.MkdirAll(*dir, 0700); err != nil {
+		log.Fatalf("could not create devnet directory: %v", err)
+	}
+	path := filepath.Join(*dir, "devnet.dat")
+	if util.FileExists(path) {
+		log.Fatalf("%v already holds a devnet, choose another directory", *dir)
+	}
+
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("could not generate vault password: %v", err)
+	}
+	password := hex.EncodeToString(secret)
+	secure, err := vault.CreateSecureVault([]byte(password), path)
+	if err != nil {
+		log.Fatalf("could not create devnet vault: %v", err)
+	}
+	derive := func(label, description string) string {
+		key, err := secure.DeriveKey(label)
+		if err != nil {
+			log.Fatalf("could not derive key %v: %v", label, err)
+		}
+		if err := secure.ImportKey(key, label, description); err != nil {
+			log.Fatalf("could not store key %v: %v", label, err)
+		}
+		return label
+	}
+	label := func(label string) string {
+		return derive(label, "devnet node")
+	}
+	next := *port
+	nextPort := func() int {
+		if next == 0 {
+			return freePort()
+		}
+		next++
+		return next - 1
+	}
+
+	topology := &Topology{Vault: path}
+	topology.Genesis = []*GenesisWallet{{Key: derive("devnet/wallet", "devnet wallet"), Balance: *funds}}
+	topology.Authority = &AuthorityTopology{
+		Key:          label("devnet/authority"),
+		IncomingPort: nextPort(),
+		OutgoingPort: nextPort(),
+		KeepBlocks:   100,
+	}
+	incoming := Link{Address: fmt.Sprintf("localhost:%v", topology.Authority.IncomingPort), Key: topology.Authority.Key}
+	outgoing := Link{Address: fmt.Sprintf("localhost:%v", topology.Authority.OutgoingPort), Key: topology.Authority.Key}
+	for n := 1; n <= *gateways; n++ {
+		topology.Gateways = append(topology.Gateways, &GatewayTopology{
+			Key:    label(fmt.Sprintf("devnet/gateway/%v", n)),
+			Port:   nextPort(),
+			Breeze: incoming,
+		})
+	}
+	for n := 1; n <= *relays; n++ {
+		topology.Relays = append(topology.Relays, &RelayTopology{
+			Key:    label(fmt.Sprintf("devnet/relay/%v", n)),
+			Port:   nextPort(),
+			Breeze: outgoing,
+			Chain:  filepath.Join(*dir, fmt.Sprintf("relay-%v.chain", n)),
+		})
+	}
+
+	data, err := json.MarshalIndent(topology, "", "  ")
+	if err != nil {
+		log.Fatalf("could not encode topology: %v", err)
+	}
+	topologyPath := filepath.Join(*dir, "topology.json")
+	if err := os.WriteFile(topologyPath, data, 0600); err != nil {
+		log.Fatalf("could not write topology: %v", err)
+	}
+
+	keys := Keyring{vault: secure}
+	fmt.Printf("devnet on %v\n", *dir)
+	fmt.Printf("  vault      %v (password %v)\n", path, password)
+	fmt.Printf("  topology   %v\n", topologyPath)
+	token := keys.Token(incoming)
+	fmt.Printf("authority    incoming localhost:%v outgoing localhost:%v token %v\n", topology.Authority.IncomingPort, topology.Authority.OutgoingPort, hex.EncodeToString(token[:]))
+	wallet := keys.Key(topology.Genesis[0].Key).PublicKey()
+	fmt.Printf("wallet       %v balance %v token %v\n", topology.Genesis[0].Key, *funds, hex.EncodeToString(wallet[:]))
+	for n, gateway := range topology.Gateways {
+		token := keys.Key(gateway.Key).PublicKey()
+		fmt.Printf("gateway %-4v localhost:%v token %v\n", n+1, gateway.Port, hex.EncodeToString(token[:]))
+	}
+	for n, relay := range topology.Relays {
+		token := keys.Key(relay.Key).PublicKey()
+		fmt.Printf("relay %-6v localhost:%v token %v\n", n+1, relay.Port, hex.EncodeToString(token[:]))
+	}
+	return topology, keys
+}
+
+// freePort asks the system for a port not in use.
+func freePort() int {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		log.Fatalf("could not find a free port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
@@ -1,21 +1,22 @@
 package main
 
 import (
-	"github.com/freehandle/breeze/crypto"
+	"context"
+
 	"github.com/freehandle/breeze/socket"
+	"github.com/freehandle/cb/social"
 	"github.com/freehandle/cb/topos"
 )
 
-func Gateway(credentials crypto.PrivateKey, node crypto.Token) chan error {
-
+func Gateway(ctx context.Context, topology *GatewayTopology, keys Keyring) (*social.Handle, error) {
+	credentials := keys.Key(topology.Key)
 	config := topos.GatewayConfig{
-		//NodeAddress: "192.168.15.83:5005",
-		NodeAddress: "localhost:5005",
-		NodeToken:   node,
+		NodeAddress: topology.Breeze.Address,
+		NodeToken:   keys.Token(topology.Breeze),
 		Credentials: credentials,
-		ListenPort:  5100,
+		ListenPort:  topology.Port,
 		Validate:    socket.AcceptAllConnections,
-		Dresser:     topos.NewBreezeVoidDresser(credentials, 0),
+		Dresser:     topos.NewBreezeVoidDresser(credentials, topology.Fee),
 	}
-	return topos.NewGateway(config)
+	return topos.NewGateway(ctx, config)
 }
@@ -1,75 +1,184 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"time"
+
+	util "github.com/freehandle/cb/config"
+	"github.com/freehandle/cb/social"
 )
 
-// relay
-// index
-// validator
-// block history
+// nodeError is the unrecoverable error of a node launched by blow.
+type nodeError struct {
+	node string
+	err  error
+}
 
-// Gateway Port 5100
-// AxeValidator Port 6000
-// AxeBlockProvider Port 6001
-// Breeze Incoming 5005
-// Breeze Outgoing 5006
+// Shutdown stages. Gateways stop first so that pending actions are forwarded
+// before the nodes downstream of breeze flush their stores and close their
+// chains. Nodes run outside cb cannot be stopped and end with the process.
+const (
+	stageGateway = iota
+	stageBlocks
+	stageValidator
+	stageChain
+	stageSource
+	unstoppable
+)
 
-func main() {
+// stoppable is a node launched with a lifecycle handle.
+type stoppable struct {
+	node   string
+	stage  int
+	handle *social.Handle
+}
 
-	environment := envs()
+func main() {
 
-	// blow breeze axe safe synergy
+	// blow <topology-file>
+	// blow devnet [--relays N] [--gateways M] [--dir path] [--port P] [--funds F]
+	// blow bench <topology-file> [--wallet <label>] [options]
 
-	args := os.Args
-	if len(os.Args) > 1 && args[1] == "synergy" {
-		synergyErr := synergyApp(breezeGatewayPk.PublicKey(), axeNodePk.PublicKey(), synergyAppPk, synergyEphemeral, environment.EmailPassword, environment.SynergyPath) // 3000 (http)
-		err := <-synergyErr
-		fmt.Println(err)
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		bench(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "devnet" {
+		topology, keys := devnet(os.Args[2:])
+		run(topology, keys)
 		return
 	}
+	if len(os.Args) != 2 {
+		fmt.Println("usage: blow <topology-file>")
+		fmt.Println("       blow devnet [--relays N] [--gateways M] [--dir path] [--port P] [--funds F]")
+		fmt.Println("       blow bench <topology-file> [--wallet <label>] [options]")
+		os.Exit(2)
+	}
+	topology := ReadTopology(os.Args[1])
+	secure, err := util.OpenExistingVault(topology.Vault)
+	if err != nil {
+		log.Fatal(err)
+	}
+	run(topology, Keyring{vault: secure})
+}
 
-	breezeerr := breeze(breezeNodePk) // incoming 5005 outgoing 5006
-	time.Sleep(200 * time.Millisecond)
-	// store, blockErr := Blocks(breezeBlocksPk, breezeNodePk.PublicKey()) // incoming 5006 why no outgoing port??
-	// time.Sleep(200 * time.Millisecond)
-	gatewayErr := Gateway(breezeGatewayPk, breezeNodePk.PublicKey()) // port 5100
-	time.Sleep(200 * time.Millisecond)
-	axenode := AxeValidator(axeNodePk, breezeNodePk.PublicKey()) // port 6000
-	time.Sleep(200 * time.Millisecond)
-	//axeProvider := AxeBlockProvider(axeBlocksPk, axeNodePk.PublicKey()) // port 6001
-	//time.Sleep(200 * time.Millisecond)
+// run launches the nodes of topology and shuts them down in order on the
+// first interrupt or terminate signal, or when a node fails. It exits with a
+// non zero status on failure.
+func run(topology *Topology, keys Keyring) {
 
-	synergyErr := synergyApp(breezeGatewayPk.PublicKey(), axeNodePk.PublicKey(), synergyAppPk, synergyEphemeral, environment.EmailPassword, environment.SynergyPath) // 3000 (http)
-	time.Sleep(200 * time.Millisecond)
-	safeServer := safeServer(breezeGatewayPk.PublicKey(), axeNodePk.PublicKey(), safeAppPk, environment.SafePath) // 7100 (http)
+	environment := envs()
+	genesis := keys.Genesis(topology.Genesis)
+
+	ctx := context.Background()
+	shutdown := util.ShutdownEvents()
+	errs := make(chan nodeError)
+	nodes := make([]stoppable, 0)
+	launch := func(node string, finalize chan error) {
+		go func() {
+			errs <- nodeError{node: node, err: <-finalize}
+		}()
+		time.Sleep(200 * time.Millisecond)
+	}
+	// stop closes the started nodes stage by stage
+	stop := func() {
+		for stage := stageGateway; stage < unstoppable; stage++ {
+			for _, n := range nodes {
+				if n.stage == stage {
+					if err := n.handle.Close(); err != nil {
+						log.Printf("%v stopped with error: %s", n.node, err)
+					} else {
+						log.Printf("%v stopped", n.node)
+					}
+				}
+			}
+		}
+	}
+	abort := func(format string, args ...any) {
+		log.Printf(format, args...)
+		stop()
+		log.Fatal("shutdown after failure")
+	}
+	start := func(node string, stage int, handle *social.Handle, err error) {
+		if err != nil {
+			abort("%v could not start: %s", node, err)
+		}
+		nodes = append(nodes, stoppable{node: node, stage: stage, handle: handle})
+		go func() {
+			errs <- nodeError{node: node, err: handle.Wait()}
+		}()
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	if topology.Breeze != nil {
+		launch("breeze", breeze(topology.Breeze, keys))
+	}
+	if topology.Authority != nil {
+		authority, err := Authority(ctx, topology.Authority, genesis, keys)
+		if err != nil {
+			abort("authority could not start: %s", err)
+		}
+		start("authority", stageSource, authority.Handle, nil)
+	}
+	for _, gateway := range topology.Gateways {
+		handle, err := Gateway(ctx, gateway, keys)
+		start(fmt.Sprintf("gateway %v", gateway.Key), stageGateway, handle, err)
+	}
+	if topology.AxeValidator != nil {
+		handle, err := AxeValidator(ctx, topology.AxeValidator, keys)
+		start("axe node", stageValidator, handle, err)
+	}
+	if topology.AxeBlocks != nil {
+		handle, err := AxeBlockProvider(ctx, topology.AxeBlocks, keys)
+		start("axe block provider", stageBlocks, handle, err)
+	}
+	for _, relay := range topology.Relays {
+		handle, err := Relay(ctx, relay, genesis, keys)
+		start(fmt.Sprintf("relay %v", relay.Key), stageChain, handle, err)
+	}
+	if topology.IndexDB != nil {
+		handle, err := IndexDB(ctx, topology.IndexDB, keys)
+		start("index db", stageChain, handle, err)
+	}
+	if topology.Synergy != nil {
+		path := topology.Synergy.Path
+		if path == "" {
+			path = environment.SynergyPath
+		}
+		launch("synergy server", synergyApp(topology.Synergy, keys, environment.EmailPassword, path))
+	}
+	if topology.Safe != nil {
+		path := topology.Safe.Path
+		if path == "" {
+			path = environment.SafePath
+		}
+		launch("safe server", safeServer(topology.Safe, keys, path))
+	}
 
 	//go ListenAndServe(store) // block listener
 
-	//socailListener := testListener(axeProviderCredentials.PublicKey(), axeValidatorCredentials.PublicKey())
-	//time.Sleep(200 * time.Millisecond)
-	//go transferspacket(pk, myCredentials.PublicKey())
-	//go axetest(pk, myCredentials.PublicKey())
+	// node keys are read at launch, the vault lock is released for safe and
+	// blow bench
+	keys.vault.Close()
+
 	select {
-	//case err := <-blockErr:
-	//	log.Fatalf("block store unrecovarable error: %s", err)
-	case err := <-gatewayErr:
-		log.Fatalf("gateway unrecovarable error: %s", err)
-	case err := <-axenode:
-		log.Fatalf("axe node unrecovarable error: %s", err)
-	//case err := <-axeProvider:
-	//	log.Fatalf("axe block provider unrecovarable error: %s", err)
-	case err := <-breezeerr:
-		log.Fatalf("breeze unrecovarable error: %s", err)
-	case err := <-safeServer:
-		log.Fatalf("safe server unrecovarable error: %s", err)
-	case err := <-synergyErr:
-		log.Fatalf("synergy server unrecovarable error: %s", err)
-	}
-	//case err := <-socailListener:
-	//		log.Fatalf("social listener unrecovarable error: %s", err)
+	case err := <-errs:
+		go forceExit(shutdown)
+		abort("%v unrecovarable error: %s", err.node, err.err)
+	case <-shutdown:
+		log.Print("shutting down")
+		go forceExit(shutdown)
+	}
+	stop()
+	log.Print("shutdown complete")
+}
 
+// forceExit ends the process on a further shutdown signal.
+func forceExit(shutdown chan os.Signal) {
+	<-shutdown
+	log.Print("forced shutdown")
+	os.Exit(1)
 }
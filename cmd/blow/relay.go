@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/socket"
+	"github.com/freehandle/cb/index"
+	"github.com/freehandle/cb/social"
+	"github.com/freehandle/cb/topos"
+)
+
+func Relay(ctx context.Context, topology *RelayTopology, genesis map[crypto.Token]uint64, keys Keyring) (*social.Handle, error) {
+	chain, err := topos.OpenFSBlockchain(topology.Chain, false)
+	if err != nil {
+		return nil, fmt.Errorf("could not open blockchain: %v", err)
+	}
+	if err := chain.UpdateState(topos.NewWallets(0, genesis)); err != nil {
+		chain.Close()
+		return nil, fmt.Errorf("could not replay blockchain: %v", err)
+	}
+	config := topos.RelayConfig{
+		SourceAddress: topology.Breeze.Address,
+		SourceToken:   keys.Token(topology.Breeze),
+		Credentials:   keys.Key(topology.Key),
+		ListenPort:    topology.Port,
+		Validate:      socket.AcceptAllConnections,
+	}
+	handle, err := topos.NewRelay(ctx, config, chain)
+	if err != nil {
+		chain.Close()
+	}
+	return handle, err
+}
+
+func IndexDB(ctx context.Context, topology *IndexDBTopology, keys Keyring) (*social.Handle, error) {
+	chain, err := topos.OpenFSBlockchain(topology.Chain, false)
+	if err != nil {
+		return nil, fmt.Errorf("could not open blockchain: %v", err)
+	}
+	config := index.DBConfig{
+		SourceAddress: topology.Breeze.Address,
+		SourceToken:   keys.Token(topology.Breeze),
+		Credentials:   keys.Key(topology.Key),
+		ListenPort:    topology.Port,
+		Validate:      socket.AcceptAllConnections,
+	}
+	handle, err := index.NewDB(ctx, config, index.OpenFileStoreIndex([index.NStores]string{topology.Index}), chain)
+	if err != nil {
+		chain.Close()
+	}
+	return handle, err
+}
@@ -1,18 +1,17 @@
 package main
 
 import (
-	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/safe"
 )
 
-func safeServer(gateway crypto.Token, axe crypto.Token, safePK crypto.PrivateKey, path string) chan error {
+func safeServer(topology *SafeTopology, keys Keyring, path string) chan error {
 	config := safe.SafeConfig{
-		GatewayAddress: "localhost:5100",
-		GatewayToken:   gateway,
-		AxeAddress:     "localhost:6000",
-		AxeToken:       axe,
-		Credentials:    safePK,
-		Port:           7100,
+		GatewayAddress: topology.Gateway.Address,
+		GatewayToken:   keys.Token(topology.Gateway),
+		AxeAddress:     topology.Axe.Address,
+		AxeToken:       keys.Token(topology.Axe),
+		Credentials:    keys.Key(topology.Key),
+		Port:           topology.Port,
 	}
 	return safe.NewServer(config, path)
 
@@ -1,19 +0,0 @@
-package main
-
-import "github.com/freehandle/breeze/crypto"
-
-var (
-	breezeNodePk     = crypto.PrivateKey{73, 113, 70, 160, 238, 25, 81, 104, 95, 227, 91, 202, 115, 216, 77, 64, 2, 2, 210, 234, 54, 149, 55, 113, 21, 185, 9, 250, 60, 222, 227, 127, 193, 104, 8, 201, 87, 72, 130, 170, 105, 81, 224, 143, 117, 80, 244, 201, 207, 2, 77, 224, 239, 35, 115, 238, 162, 238, 216, 82, 102, 107, 173, 70}
-	breezeBlocksPk   = crypto.PrivateKey{95, 201, 179, 125, 151, 57, 109, 17, 236, 95, 163, 49, 50, 135, 133, 148, 146, 80, 203, 226, 218, 188, 23, 98, 87, 191, 66, 85, 222, 25, 248, 96, 190, 9, 14, 238, 91, 170, 194, 29, 58, 89, 27, 217, 106, 127, 138, 28, 32, 249, 58, 107, 54, 252, 84, 168, 222, 131, 186, 2, 148, 68, 211, 46}
-	breezeGatewayPk  = crypto.PrivateKey{221, 47, 73, 199, 90, 253, 206, 195, 171, 154, 235, 29, 214, 249, 156, 224, 87, 236, 90, 117, 130, 21, 21, 206, 187, 77, 99, 46, 236, 21, 81, 95, 1, 144, 213, 177, 38, 4, 87, 55, 161, 48, 94, 100, 196, 203, 252, 140, 138, 17, 196, 74, 38, 217, 88, 91, 171, 127, 58, 185, 83, 109, 143, 34}
-	axeNodePk        = crypto.PrivateKey{38, 248, 137, 48, 18, 85, 115, 90, 73, 138, 224, 174, 57, 61, 206, 69, 93, 178, 94, 170, 225, 65, 53, 175, 222, 102, 49, 29, 110, 86, 161, 133, 66, 123, 91, 127, 93, 67, 96, 78, 137, 65, 106, 202, 187, 231, 186, 248, 216, 177, 30, 150, 115, 34, 248, 23, 75, 45, 206, 91, 234, 86, 135, 28}
-	axeBlocksPk      = crypto.PrivateKey{176, 112, 206, 90, 49, 26, 52, 105, 181, 200, 225, 81, 236, 202, 89, 56, 126, 234, 202, 119, 237, 204, 8, 244, 241, 23, 3, 182, 160, 102, 184, 142, 10, 65, 26, 251, 129, 127, 41, 27, 196, 70, 74, 148, 218, 217, 201, 137, 254, 222, 16, 56, 12, 29, 61, 163, 214, 146, 249, 90, 111, 119, 2, 176}
-	safeAppPk        = crypto.PrivateKey{135, 150, 6, 169, 203, 57, 36, 237, 192, 225, 49, 255, 140, 190, 127, 125, 112, 178, 162, 16, 235, 177, 65, 91, 4, 67, 40, 207, 49, 129, 24, 177, 150, 230, 158, 108, 160, 205, 213, 68, 139, 245, 114, 198, 224, 81, 144, 110, 237, 49, 252, 19, 15, 106, 172, 44, 212, 15, 75, 62, 25, 68, 13, 197}
-	synergyAppPk     = crypto.PrivateKey{26, 212, 115, 82, 27, 241, 131, 107, 212, 112, 6, 166, 16, 97, 235, 154, 13, 130, 201, 222, 8, 122, 182, 234, 33, 90, 255, 23, 187, 153, 27, 227, 51, 160, 12, 182, 21, 115, 75, 88, 219, 168, 105, 48, 79, 23, 230, 195, 197, 109, 64, 197, 113, 39, 235, 162, 248, 139, 239, 89, 239, 221, 27, 235}
-	synergyEphemeral = crypto.PrivateKey{102, 184, 129, 168, 166, 43, 141, 143, 18, 165, 30, 233, 178, 249, 134, 172, 245, 184, 128, 74, 96, 166, 187, 148, 102, 68, 188, 107, 18, 223, 6, 251, 119, 243, 220, 196, 164, 253, 153, 227, 122, 244, 65, 0, 93, 231, 122, 174, 126, 29, 102, 238, 120, 250, 148, 220, 221, 157, 22, 88, 237, 160, 161, 123}
-	/*extra keys
-
-	{180,128,0,228,150,44,176,215,49,204,224,241,80,137,154,23,61,230,108,238,93,153,142,153,235,230,151,70,137,109,140,169,80,169,242,101,61,211,84,175,46,211,171,88,242,189,175,47,78,170,26,97,230,141,187,3,79,218,119,95,23,255,245,192}
-	{189,88,154,131,168,10,4,245,55,68,254,51,119,128,67,103,113,135,241,34,78,197,89,175,132,221,237,21,51,172,179,180,94,69,56,194,132,226,200,132,78,2,215,63,156,80,220,81,208,150,184,152,183,116,253,22,12,22,121,173,189,203,89,78}
-	*/
-)
@@ -2,6 +2,8 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"path/filepath"
 
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/cb/vault"
@@ -11,7 +13,9 @@ import (
 	"github.com/freehandle/synergy/social/state"
 )
 
-func synergyApp(gatewayToken crypto.Token, axeNodeToken crypto.Token, credentials, ephemeral crypto.PrivateKey, emailpassword, path string) chan error {
+func synergyApp(topology *SynergyTopology, keys Keyring, emailpassword, path string) chan error {
+	credentials := keys.Key(topology.Key)
+	ephemeral := keys.Key(topology.Ephemeral)
 	indexer := index.NewIndex()
 	genesis := state.GenesisState(indexer)
 	indexer.SetState(genesis)
@@ -19,17 +23,24 @@ func synergyApp(gatewayToken crypto.Token, axeNodeToken crypto.Token, credential
 
 	gateway := make(chan []byte)
 
-	vault := vault.SecureVault{
-		Secrets: make(map[crypto.Token]crypto.PrivateKey),
+	finalize := make(chan error, 2)
+	secrets, err := vault.NewMemoryVault()
+	if err != nil {
+		finalize <- fmt.Errorf("could not create vault: %v", err)
+		return finalize
+	}
+	for _, key := range []crypto.PrivateKey{credentials, ephemeral} {
+		if err := secrets.ImportKey(key, "", ""); err != nil {
+			finalize <- fmt.Errorf("could not import key to vault: %v", err)
+			return finalize
+		}
 	}
-	vault.Secrets[credentials.PublicKey()] = credentials
-	vault.Secrets[ephemeral.PublicKey()] = ephemeral
 
-	cookieStore := api.OpenCokieStore("synergycookies.dat", genesis)
-	passwordManager := api.NewFilePasswordManager("synergypasswords.dat")
+	cookieStore := api.OpenCokieStore(filepath.Join(path, "synergycookies.dat"), genesis)
+	passwordManager := api.NewFilePasswordManager(filepath.Join(path, "synergypasswords.dat"))
 
 	config := api.ServerConfig{
-		Vault:         &vault,
+		Vault:         secrets,
 		Attorney:      credentials.PublicKey(),
 		Ephemeral:     ephemeral.PublicKey(),
 		Passwords:     passwordManager,
@@ -39,7 +50,7 @@ func synergyApp(gatewayToken crypto.Token, axeNodeToken crypto.Token, credential
 		State:         genesis,
 		GenesisTime:   genesis.GenesisTime,
 		EmailPassword: emailpassword,
-		Port:          3000,
+		Port:          topology.Port,
 		Path:          path,
 	}
 
@@ -48,6 +59,6 @@ func synergyApp(gatewayToken crypto.Token, axeNodeToken crypto.Token, credential
 		finalize <- errors.New("could not create attorney server")
 		return finalize
 	}
-	network.LaunchProxy("localhost:6000", "localhost:5100", axeNodeToken, gatewayToken, credentials, gateway, attorney)
+	network.LaunchProxy(topology.Axe.Address, topology.Gateway.Address, keys.Token(topology.Axe), keys.Token(topology.Gateway), credentials, gateway, attorney)
 	return finalize
 }
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/hex"
+	"log"
+
+	"github.com/freehandle/breeze/crypto"
+	util "github.com/freehandle/cb/config"
+	"github.com/freehandle/cb/vault"
+)
+
+// Topology declares the nodes run by blow, their ports and the links between
+// them. It is read from a JSON file. Node keys are referenced by their label
+// on the vault, so that no key is kept on the file; they are created with
+// safe <vault> new <label>. Nodes left out are not run.
+type Topology struct {
+	Vault        string           // vault file holding the node keys
+	Genesis      []*GenesisWallet // balances of the authority and relay states
+	Breeze       *BreezeTopology
+	Authority    *AuthorityTopology // in process stand in for breeze
+	Gateways     []*GatewayTopology
+	AxeValidator *AxeValidatorTopology
+	AxeBlocks    *AxeBlocksTopology
+	Relays       []*RelayTopology
+	IndexDB      *IndexDBTopology
+	Safe         *SafeTopology
+	Synergy      *SynergyTopology
+}
+
+// Link is a connection to an upstream node. Its token is given either by the
+// vault label of the node key, for nodes of the same topology, or in hex.
+type Link struct {
+	Address string // url:port
+	Key     string
+	Token   string
+}
+
+// GenesisWallet is a balance of the genesis state. Its wallet is given either
+// by the vault label of its key or by its token in hex.
+type GenesisWallet struct {
+	Key     string
+	Token   string
+	Balance uint64
+}
+
+// BreezeTopology is a breeze proof of authority node.
+type BreezeTopology struct {
+	Key          string
+	IncomingPort int // gateways connect to this port
+	OutgoingPort int // block listeners connect to this port
+	KeepBlocks   int
+}
+
+// AuthorityTopology is a cb single authority node. It serves relays and index
+// dbs, and accepts actions from gateways, but not breeze block listeners.
+type AuthorityTopology struct {
+	Key           string
+	IncomingPort  int // gateways connect to this port
+	OutgoingPort  int // relays and index dbs connect to this port
+	KeepBlocks    int
+	BlockInterval int // milliseconds, one second if zero
+}
+
+type GatewayTopology struct {
+	Key    string
+	Port   int
+	Breeze Link // incoming port of the breeze node
+	Fee    uint64
+}
+
+type AxeValidatorTopology struct {
+	Key        string
+	Port       int
+	Breeze     Link // outgoing port of the breeze node
+	KeepBlocks int
+}
+
+type AxeBlocksTopology struct {
+	Key       string
+	Port      int
+	Validator Link
+	Path      string // block store file
+}
+
+type RelayTopology struct {
+	Key    string
+	Port   int
+	Breeze Link   // outgoing port of the breeze node
+	Chain  string // blockchain file
+}
+
+type IndexDBTopology struct {
+	Key    string
+	Port   int
+	Breeze Link   // outgoing port of the breeze node
+	Chain  string // blockchain file
+	Index  string // index store file
+}
+
+type SafeTopology struct {
+	Key     string
+	Port    int
+	Gateway Link
+	Axe     Link
+	Path    string // defaults to the SAFE environment variable
+}
+
+type SynergyTopology struct {
+	Key       string
+	Ephemeral string
+	Port      int
+	Gateway   Link
+	Axe       Link
+	Path      string // defaults to the SYNERGY_PATH environment variable, holds the cookie and password files
+}
+
+func ReadTopology(path string) *Topology {
+	var topology Topology
+	util.ReadConfigFile(path, &topology)
+	if topology.Vault == "" {
+		log.Fatalf("topology file %v does not declare a vault", path)
+	}
+	return &topology
+}
+
+// Keyring resolves the keys of a topology on its vault.
+type Keyring struct {
+	vault *vault.SecureVault
+}
+
+func (k Keyring) Key(label string) crypto.PrivateKey {
+	entry, ok := k.vault.EntryByLabel(label)
+	if !ok {
+		log.Fatalf("key %v not found on vault", label)
+	}
+	return entry.Key
+}
+
+func (k Keyring) Token(link Link) crypto.Token {
+	if link.Key != "" {
+		return k.Key(link.Key).PublicKey()
+	}
+	bytes, err := hex.DecodeString(link.Token)
+	if err != nil || len(bytes) != crypto.Size {
+		log.Fatalf("invalid token for %v", link.Address)
+	}
+	var token crypto.Token
+	copy(token[:], bytes)
+	return token
+}
+
+// Genesis returns the genesis balances of wallets by token.
+func (k Keyring) Genesis(wallets []*GenesisWallet) map[crypto.Token]uint64 {
+	genesis := make(map[crypto.Token]uint64)
+	for _, wallet := range wallets {
+		genesis[k.Token(Link{Address: "genesis wallet", Key: wallet.Key, Token: wallet.Token})] += wallet.Balance
+	}
+	return genesis
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/freehandle/cb/agent"
+	"github.com/freehandle/cb/vault"
+)
+
+// agentPolicies is the format of the optional policy file of the agent
+// command.
+type agentPolicies struct {
+	LockAfterMinutes int
+	Policies         map[string]agent.Policy
+	Default          *agent.Policy
+}
+
+func serveAgent(safe *vault.SecureVault, path string, args ...string) int {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError(helpAgent)
+	}
+	policies := agentPolicies{
+		LockAfterMinutes: 15,
+		Default:          &agent.Policy{Callers: []uint32{uint32(os.Getuid())}},
+	}
+	if len(args) == 2 {
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			return fail(exitFailure, "Could not read policy file: %v", err)
+		}
+		// fields the file omits keep their defaults
+		if err := json.Unmarshal(data, &policies); err != nil {
+			return fail(exitFailure, "Could not parse policy file: %v", err)
+		}
+	}
+	config := agent.Config{
+		Socket:    args[0],
+		Vault:     path,
+		LockAfter: time.Duration(policies.LockAfterMinutes) * time.Minute,
+		Policies:  policies.Policies,
+		Default:   policies.Default,
+	}
+	finalize := agent.Serve(config, safe)
+	// the agent holds its own copy of the keys and reopens the vault on unlock
+	safe.Close()
+	select {
+	case err := <-finalize:
+		return fail(exitFailure, "%v", err)
+	default:
+	}
+	report(map[string]string{"socket": args[0]}, "Signing agent listening on %v\n", args[0])
+	err := <-finalize
+	return fail(exitFailure, "%v", err)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/freehandle/axe/attorney"
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/actions"
+	"github.com/freehandle/cb/attorneys"
+	"github.com/freehandle/cb/vault"
+)
+
+// attorneyAction signs an axe action built for the current epoch with the
+// vault key and dresses it for breeze, paying the configured fee.
+func attorneyAction(safe *vault.SecureVault, settings *Settings, usage string, build func(key crypto.PrivateKey, attorney crypto.Token, epoch uint64) []byte, args ...string) int {
+	if len(args) != 2 {
+		return usageError(usage)
+	}
+	key, ok := walletKey(safe, args[0])
+	if !ok {
+		return exitFailure
+	}
+	token, ok := parseToken(args[1])
+	if !ok {
+		return fail(exitUsage, "Invalid token %v", args[1])
+	}
+	return submit(settings, key.PublicKey(), settings.Fee, 0, func(epoch uint64) []byte {
+		return actions.Dress(build(key, token, epoch), key, settings.Fee)
+	})
+}
+
+func grant(safe *vault.SecureVault, settings *Settings, args ...string) int {
+	return attorneyAction(safe, settings, helpGrant, func(key crypto.PrivateKey, token crypto.Token, epoch uint64) []byte {
+		grant := attorney.GrantPowerOfAttorney{
+			Epoch:    epoch,
+			Author:   key.PublicKey(),
+			Attorney: token,
+		}
+		grant.Sign(key)
+		return grant.Serialize()
+	}, args...)
+}
+
+func revoke(safe *vault.SecureVault, settings *Settings, args ...string) int {
+	return attorneyAction(safe, settings, helpRevoke, func(key crypto.PrivateKey, token crypto.Token, epoch uint64) []byte {
+		revoke := attorney.RevokePowerOfAttorney{
+			Epoch:    epoch,
+			Author:   key.PublicKey(),
+			Attorney: token,
+		}
+		revoke.Sign(key)
+		return revoke.Serialize()
+	}, args...)
+}
+
+func listAttorneys(safe *vault.SecureVault, settings *Settings, args ...string) int {
+	if len(args) != 1 {
+		return usageError(helpAttorneys)
+	}
+	token, ok := findToken(safe, args[0])
+	if !ok {
+		if token, ok = parseToken(args[0]); !ok {
+			return fail(exitFailure, "Key %v not found on vault", args[0])
+		}
+	}
+	address, node, err := settings.Axe()
+	if err != nil {
+		return fail(exitFailure, "%v", err)
+	}
+	_, ephemeral := crypto.RandomAsymetricKey()
+	tokens, err := attorneys.RequestAttorneys(address, node, ephemeral, token)
+	if err != nil {
+		return fail(exitFailure, "Could not get attorneys: %v", err)
+	}
+	granted := make([]string, len(tokens))
+	for n, attorney := range tokens {
+		granted[n] = hex.EncodeToString(attorney[:])
+	}
+	if options.json {
+		report(map[string]any{"token": hex.EncodeToString(token[:]), "attorneys": granted}, "")
+		return exitOK
+	}
+	for _, attorney := range granted {
+		fmt.Println(attorney)
+	}
+	return exitOK
+}
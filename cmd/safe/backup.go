@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/freehandle/cb/vault"
+)
+
+func exportBundle(safe *vault.SecureVault, args ...string) int {
+	if len(args) != 1 {
+		return usageError(helpExport)
+	}
+	password, ok := readPassphrase("Enter export pass phrase:")
+	if !ok {
+		return exitFailure
+	}
+	bundle, err := safe.ExportBundle(password)
+	if err != nil {
+		return fail(exitFailure, "Could not export vault: %v", err)
+	}
+	if err := os.WriteFile(args[0], bundle, 0600); err != nil {
+		return fail(exitFailure, "Could not write bundle file: %v", err)
+	}
+	report(map[string]string{"bundle": args[0]}, "Vault exported to %v\n", args[0])
+	return exitOK
+}
+
+func importBundle(safe *vault.SecureVault, args ...string) int {
+	if len(args) != 1 {
+		return usageError(helpImport)
+	}
+	bundle, err := os.ReadFile(args[0])
+	if err != nil {
+		return fail(exitFailure, "Could not read bundle file: %v", err)
+	}
+	password, ok := readPassphrase("Enter export pass phrase:")
+	if !ok {
+		return exitFailure
+	}
+	count, err := safe.ImportBundle(bundle, password)
+	if err != nil {
+		return fail(exitFailure, "Could not import bundle: %v", err)
+	}
+	report(map[string]int{"imported": count}, "%v keys imported\n", count)
+	return exitOK
+}
+
+func printMnemonic(safe *vault.SecureVault) int {
+	notice("Write down the words below and keep them offline. Anyone with them can\n")
+	notice("recover the vault secret key.\n")
+	report(map[string]string{"mnemonic": safe.Mnemonic()}, "%v\n", safe.Mnemonic())
+	return exitOK
+}
+
+// recoverVault creates a new vault file either from a mnemonic phrase or from
+// a backup bundle.
+func recoverVault(path, command string, args ...string) int {
+	if stat, _ := os.Stat(path); stat != nil {
+		return fail(exitFailure, "File already exists")
+	}
+	var bundle, exportPassword []byte
+	var phrase string
+	if command == "restore" {
+		if len(args) != 1 {
+			return usageError(helpRestore)
+		}
+		var err error
+		if bundle, err = os.ReadFile(args[0]); err != nil {
+			return fail(exitFailure, "Could not read bundle file: %v", err)
+		}
+		var ok bool
+		if exportPassword, ok = readPassphrase("Enter export pass phrase:"); !ok {
+			return exitFailure
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, "Enter mnemonic phrase:")
+		reader := bufio.NewReader(os.Stdin)
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			return fail(exitFailure, "Error reading mnemonic: %v", err)
+		}
+		phrase = line
+	}
+	password, ok := readPassphrase("Enter pass phrase to secure safe vault:")
+	if !ok {
+		return exitFailure
+	}
+	var safe *vault.SecureVault
+	var err error
+	if command == "restore" {
+		safe, err = vault.RestoreBundle(bundle, exportPassword, password, path)
+	} else {
+		safe, err = vault.RecoverSecureVault(password, path, phrase)
+	}
+	if err != nil {
+		return fail(exitFailure, "Could not recover vault: %v", err)
+	}
+	defer safe.Close()
+	token := safe.SecretKey.PublicKey()
+	recovered := hex.EncodeToString(token[:])
+	report(map[string]string{"token": recovered}, "Vault recovered with token %v\n", recovered)
+	return exitOK
+}
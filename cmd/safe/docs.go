@@ -1,8 +1,231 @@
 package main
 
-const helpNew = `usage: safe <path-tovault-file> new
+const helpNew = `usage: safe <path-tovault-file> new [label]
 
 New generates a random ED25519 cryptographic key-pair and store the private
-key on the secure vault file. The public key is printed to the standard output.
+key on the secure vault file, under label if one is given. Labels must be
+unique on the vault. The public key is printed to the standard output.
+
+`
+
+const helpList = `usage: safe <path-tovault-file> list
+
+List prints the token, the type and the label of every key and stage secrets
+stored on the secure vault file, one per line. Types are key, wallet and stage.
+Stage secrets are listed by the token of their ownership key. The vault secret
+key is labeled vault.
+
+`
+
+const helpRetire = `usage: safe <path-tovault-file> retire <label|token>
+
+Retire appends a tombstone to the secure vault file for the key identified by
+label or by its hex encoded token. A retired key is no longer listed nor used,
+but remains on the vault file until it is compacted. The vault secret key
+cannot be retired.
+
+`
+
+const helpCompact = `usage: safe <path-tovault-file> compact
+
+Compact rewrites the secure vault file without retired keys and revoked stage
+secrets. The vault file is only replaced once the compacted file is fully
+written.
+
+`
+
+const helpExport = `usage: safe <path-tovault-file> export <bundle-file>
+
+Export writes every key and stage secrets on the vault, except retired ones,
+to a portable bundle file encrypted under an export pass phrase independent of
+the vault pass phrase.
+
+`
+
+const helpImport = `usage: safe <path-tovault-file> import <bundle-file>
+
+Import incorporates into the vault every key and stage secrets of a bundle file
+not already on the vault. The secret key of the exporting vault is imported as
+an unlabeled key.
+
+`
+
+const helpMnemonic = `usage: safe <path-tovault-file> mnemonic
+
+Mnemonic prints the phrase of 33 words from which the vault secret key can be
+recovered with the recover command.
+
+`
+
+const helpRecover = `usage: safe <path-to-new-vault-file> recover
+
+Recover creates a new vault file whose secret key is recovered from the
+mnemonic phrase read from the standard input.
+
+`
+
+const helpRestore = `usage: safe <path-to-new-vault-file> restore <bundle-file>
+
+Restore creates a new vault file with every key and stage secrets of a bundle
+file. The secret key of the new vault is the secret key of the exporting vault.
+
+`
+
+const helpAgent = `usage: safe <path-tovault-file> agent <socket-path> [policy-file]
+
+Agent serves signature requests with the vault keys over a unix socket, so
+that nodes do not need to hold their private keys. By default every key can be
+used by processes of the same user and the agent drops the keys after 15
+minutes without requests. They are loaded again on an unlock request with the
+vault pass phrase.
+
+The optional policy file is a JSON file like
+
+	{
+		"LockAfterMinutes": 60,
+		"Policies": {
+			"relay": { "Callers": [1001], "RateLimit": 600 }
+		},
+		"Default": null
+	}
+
+where Policies restricts keys by label to the listed user ids and to a maximum
+number of signatures per minute. Keys without a policy use Default, and are not
+served if Default is null. A zero LockAfterMinutes never locks the agent.
+Fields the file omits keep their default values.
+
+`
+
+const helpDerive = `usage: safe <path-tovault-file> derive <path>
+
+Derive shows the token of the key derived from the vault secret key by a path
+such as synergy/attorney/0. Derived keys are not stored on the vault: the same
+path always gives the same key, and they are recovered with the vault secret
+key alone.
+
+`
+
+const helpBalance = `usage: safe <path-tovault-file> balance <label|token>
+
+Balance shows the wallet and deposit balances of a key on the breeze network,
+and the epoch they refer to, as known by the configured relay or index node.
+Tokens not on the vault can also be queried.
+
+`
+
+const helpSend = `usage: safe <path-tovault-file> send <label|token> <to-token> <amount> [reason]
+
+Send transfers amount tokens from the wallet of a vault key to another token.
+The transfer is signed with the vault key and submitted to the configured
+gateway, with the configured fee.
+
+`
+
+const helpDeposit = `usage: safe <path-tovault-file> deposit <label|token> <amount>
+
+Deposit moves amount tokens from the wallet of a vault key to its deposit. The
+action is signed with the vault key and submitted to the configured gateway,
+with the configured fee.
+
+`
+
+const helpWithdraw = `usage: safe <path-tovault-file> withdraw <label|token> <amount>
+
+Withdraw moves amount tokens from the deposit of a vault key back to its
+wallet. The action is signed with the vault key and submitted to the
+configured gateway, with the configured fee.
+
+`
+
+const helpGrant = `usage: safe <path-tovault-file> grant <label|token> <attorney-token>
+
+Grant gives power of attorney over a vault key to another token on the axe
+protocol. The grant is signed with the vault key, dressed as a breeze action
+paying the configured fee and submitted to the configured gateway.
+
+`
+
+const helpRevoke = `usage: safe <path-tovault-file> revoke <label|token> <attorney-token>
+
+Revoke removes a power of attorney over a vault key previously granted to
+another token on the axe protocol. The revocation is signed with the vault key,
+dressed as a breeze action paying the configured fee and submitted to the
+configured gateway.
+
+`
+
+const helpAttorneys = `usage: safe <path-tovault-file> attorneys <label|token>
+
+Attorneys lists the tokens currently holding power of attorney over a vault
+key or any other token, as known by the configured axe validator node. Grants
+are listed once their block is committed. A validator only knows the grants of
+the blocks it has replayed since it started.
+
+`
+
+const helpConfig = `usage: safe config list
+       safe config get <key>
+       safe config set <key> <value>
+
+Config shows and edits the global configuration of safe, kept on
+~/.safe/config.json. The keys are:
+
+	vault          vault file used when no path is given to safe
+	gateway        address of the gateway receiving actions
+	gateway-token  token of the gateway
+	relay          address of the relay or index node answering balances
+	relay-token    token of the relay or index node
+	axe            address of the axe validator node answering attorneys
+	axe-token      token of the axe validator node
+	fee            fee offered on every action
+
+`
+
+const helpSign = `usage: safe <path-tovault-file> sign <label|token> <file|-> [hex|base64]
+
+Sign signs the contents of a file, or of stdin if - is given, with a vault key
+and prints the signature in hex, or in base64 if asked. The message is signed
+after the "cb signed message:\n" prefix, so that its signature proves ownership
+of the token off-chain but is never valid for a network action.
+
+`
+
+const helpVerify = `usage: safe [path-tovault-file] verify <token> <signature> <file|->
+
+Verify checks that a signature, in hex or base64, of the contents of a file, or
+of stdin if - is given, was made by the key of token with the sign command. It
+does not need a vault.
+Exit status is 0 for a valid signature and 1 otherwise.
+
+`
+
+const helpPrepare = `usage: safe [path-tovault-file] prepare <request-file> send <from-token> <to-token> <amount> [reason]
+       safe [path-tovault-file] prepare <request-file> deposit <from-token> <amount>
+       safe [path-tovault-file] prepare <request-file> withdraw <from-token> <amount>
+       safe [path-tovault-file] prepare <request-file> grant <from-token> <attorney-token>
+       safe [path-tovault-file] prepare <request-file> revoke <from-token> <attorney-token>
+
+Prepare writes an unsigned action of from-token to a request file, to be
+signed with safe sign-action on the machine holding the vault. The action is
+built for the current epoch given by the configured relay, with the configured
+fee. It does not need a vault. Actions expire some epochs after they are built,
+so they must be signed and submitted without delay.
+
+`
+
+const helpSignAction = `usage: safe <path-tovault-file> sign-action <request-file> [signed-file]
+
+Sign-action shows an action prepared with safe prepare and, once confirmed,
+signs it with the vault key of its signer. Axe actions are also dressed as
+breeze actions paying the fee set when prepared. The signed action replaces
+the request file, or is written to signed-file if given. It does not need
+network access.
+
+`
+
+const helpSubmit = `usage: safe [path-tovault-file] submit <signed-file>
+
+Submit sends an action signed with safe sign-action to the configured gateway.
+It does not need a vault.
 
 `
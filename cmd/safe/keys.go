@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/cb/vault"
+)
+
+// findToken resolves a vault entry by its label or by its hex encoded token.
+func findToken(safe *vault.SecureVault, labelOrToken string) (crypto.Token, bool) {
+	if entry, ok := safe.EntryByLabel(labelOrToken); ok {
+		return entry.Token(), true
+	}
+	token, ok := parseToken(labelOrToken)
+	if !ok {
+		return crypto.Token{}, false
+	}
+	if _, ok := safe.EntryByToken(token); !ok {
+		return crypto.Token{}, false
+	}
+	return token, true
+}
+
+func retire(safe *vault.SecureVault, args ...string) int {
+	if len(args) != 1 {
+		return usageError(helpRetire)
+	}
+	token, ok := findToken(safe, args[0])
+	if !ok {
+		return fail(exitFailure, "Key %v not found on vault", args[0])
+	}
+	if err := safe.RevokeKey(token); err != nil {
+		return fail(exitFailure, "Could not retire key: %v", err)
+	}
+	retired := hex.EncodeToString(token[:])
+	report(map[string]string{"retired": retired}, "Key %v retired\n", retired)
+	return exitOK
+}
+
+func compact(safe *vault.SecureVault) int {
+	if err := safe.Compact(); err != nil {
+		return fail(exitFailure, "Could not compact vault: %v", err)
+	}
+	report(map[string]bool{"compacted": true}, "Vault compacted\n")
+	return exitOK
+}
+
+func derive(safe *vault.SecureVault, args ...string) int {
+	if len(args) != 1 {
+		return usageError(helpDerive)
+	}
+	key, err := safe.DeriveKey(args[0])
+	if err != nil {
+		return fail(exitFailure, "Could not derive key: %v", err)
+	}
+	token := key.PublicKey()
+	derived := hex.EncodeToString(token[:])
+	report(map[string]string{"path": args[0], "token": derived}, "%v: %v\n", args[0], derived)
+	return exitOK
+}
+
+func newKey(safe *vault.SecureVault, args ...string) int {
+	if len(args) > 1 {
+		return usageError(helpNew)
+	}
+	var token crypto.Token
+	var err error
+	if len(args) == 1 {
+		token, _, err = safe.GenerateLabeledKey(vault.TypePrivateKey, args[0], "")
+	} else {
+		token, _, err = safe.NewKey()
+	}
+	if err != nil {
+		return fail(exitFailure, "Could not generate key: %v", err)
+	}
+	generated := hex.EncodeToString(token[:])
+	report(map[string]string{"token": generated}, "%v\n", generated)
+	return exitOK
+}
+
+func typeName(kind byte) string {
+	switch kind {
+	case vault.TypePrivateKey:
+		return "key"
+	case vault.TypeWalletPrivateKey:
+		return "wallet"
+	case vault.TypeStageSecrets:
+		return "stage"
+	}
+	return "unknown"
+}
+
+// listedKey is an entry of the list command output.
+type listedKey struct {
+	Token string `json:"token"`
+	Type  string `json:"type"`
+	Label string `json:"label"`
+}
+
+func list(safe *vault.SecureVault, args ...string) int {
+	if len(args) > 0 {
+		return usageError(helpList)
+	}
+	keys := make([]listedKey, 0)
+	for _, entry := range safe.Entries() {
+		token := entry.Token()
+		keys = append(keys, listedKey{Token: hex.EncodeToString(token[:]), Type: typeName(entry.Type), Label: entry.Label})
+	}
+	for _, stage := range safe.StageEntries() {
+		token := stage.Token()
+		keys = append(keys, listedKey{Token: hex.EncodeToString(token[:]), Type: typeName(vault.TypeStageSecrets), Label: stage.Label})
+	}
+	if options.json {
+		report(keys, "")
+		return exitOK
+	}
+	for _, key := range keys {
+		fmt.Printf("%v  %-6v  %v\n", key.Token, key.Type, key.Label)
+	}
+	return exitOK
+}
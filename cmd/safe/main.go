@@ -1,90 +1,260 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"strings"
 
+	util "github.com/freehandle/cb/config"
 	"github.com/freehandle/cb/vault"
-	"golang.org/x/crypto/ssh/terminal"
 )
 
 var usage = `Usage: 
 
-	safe <path-to-vault-file> <command> [arguments]
+	safe [options] [path-to-vault-file] <command> [arguments]
 
 The commands are:
 
-	new       create new random key pair and secure them on vault
-   	balance   show balance of tokens associated to the key on breeze network
-	config    global configuration for safe command
-   	deposit   deposit token balance for a key on breeze network 
-	grant     grant power of attorney to another key on axe protocol
-	list      list all know tokens 
-	revoke    revoke power of attorney to another key on axe protocol
-	send      transfer token to another key
-	withdraw  withdraw token associated to key on breeze network
+	new          create new random key pair and secure them on vault
+	agent        serve signatures with vault keys over a unix socket
+	attorneys    list keys holding power of attorney for a key on axe protocol
+	balance      show balance of tokens associated to the key on breeze network
+	compact      remove retired keys from vault file
+	config       global configuration for safe command
+	deposit      deposit token balance for a key on breeze network 
+	derive       show token of a key derived from the vault secret key
+	export       export vault keys to an encrypted backup bundle
+	grant        grant power of attorney to another key on axe protocol
+	import       import keys from an encrypted backup bundle
+	list         list all know tokens 
+	mnemonic     print mnemonic phrase of the vault secret key
+	prepare      prepare an unsigned action to be signed offline
+	recover      create vault from mnemonic phrase
+	restore      create vault from an encrypted backup bundle
+	retire       retire a key from the vault
+	revoke       revoke power of attorney to another key on axe protocol
+	send         transfer token to another key
+	sign         sign a message with a vault key
+	sign-action  sign an action prepared with safe prepare
+	submit       submit an action signed with safe sign-action to the gateway
+	verify       verify the signature of a message by a token
+	withdraw     withdraw token associated to key on breeze network
 	
 
+The vault file may be omitted when a default vault is configured with
+"safe config set vault <path>".
+
+The options are:
+
+	--passphrase-fd <fd>      read pass phrases from a file descriptor
+	--passphrase-file <path>  read pass phrases from a file
+	--passphrase-env <var>    read pass phrases from an environment variable
+	--yes                     create the vault file without asking
+	--json                    print results and errors as JSON
+
+Pass phrase sources hold one pass phrase per line, in the order the command
+asks for them.
+
 Use "safe help <command>" for more information about a command.
 
+Exit status is 0 on success, 1 if the command fails and 2 on usage errors.
+
 `
 
+// Exit codes of the safe command.
+const (
+	exitOK      = 0
+	exitFailure = 1 // the command could not be carried out
+	exitUsage   = 2 // wrong command or arguments
+)
+
+// help is the help text of every implemented command.
+var help = map[string]string{
+	"new":         helpNew,
+	"list":        helpList,
+	"retire":      helpRetire,
+	"compact":     helpCompact,
+	"agent":       helpAgent,
+	"derive":      helpDerive,
+	"export":      helpExport,
+	"import":      helpImport,
+	"mnemonic":    helpMnemonic,
+	"recover":     helpRecover,
+	"restore":     helpRestore,
+	"balance":     helpBalance,
+	"send":        helpSend,
+	"deposit":     helpDeposit,
+	"withdraw":    helpWithdraw,
+	"grant":       helpGrant,
+	"revoke":      helpRevoke,
+	"attorneys":   helpAttorneys,
+	"config":      helpConfig,
+	"sign":        helpSign,
+	"verify":      helpVerify,
+	"prepare":     helpPrepare,
+	"sign-action": helpSignAction,
+	"submit":      helpSubmit,
+}
+
 func ParseCommand(params ...string) {
 	if len(params) == 0 {
 		return
 	}
 	if params[0] == "help" {
 		if len(params) > 1 {
-			if params[1] == "new" {
-				fmt.Print(helpNew)
-				os.Exit(0)
+			if text, ok := help[params[1]]; ok {
+				fmt.Print(text)
+				os.Exit(exitOK)
 			}
+			fmt.Printf("Unknown command %v\n", params[1])
+			os.Exit(exitUsage)
 		}
+		fmt.Print(usage)
+		os.Exit(exitOK)
 	}
 }
 
 func main() {
-	ParseCommand(os.Args[1:]...)
-	if len(os.Args) < 2 {
-		fmt.Println(usage)
-		return
+	args, ok := parseOptions(os.Args[1:])
+	if !ok {
+		os.Exit(exitUsage)
 	}
-	var safe *vault.SecureVault
-	if stat, _ := os.Stat(os.Args[1]); stat == nil {
-		fmt.Print("File does not exist. Create new [yes/no]?")
-		var yes string
-		fmt.Scan(&yes)
-		yes = strings.TrimSpace(strings.ToLower(yes))
-		if yes == "yes" || yes == "y" {
-			fmt.Println("Enter pass phrase to secure safe vault:")
-			password, err := terminal.ReadPassword(0)
-			if err != nil {
-				fmt.Printf("Error reading password: %v\n", err)
-				return
-			}
-			safe = vault.NewSecureVault([]byte(password), os.Args[1])
-			if safe == nil {
-				fmt.Println("Could not create vault")
-				return
-			}
-		} else {
-			return
+	ParseCommand(args...)
+	os.Exit(run(args...))
+}
+
+func run(args ...string) int {
+	if len(args) == 0 {
+		fmt.Print(usage)
+		return exitUsage
+	}
+	settings, err := loadSettings()
+	if err != nil {
+		return fail(exitFailure, "%v", err)
+	}
+	if _, ok := help[args[0]]; ok && !util.FileExists(args[0]) {
+		// no vault path given, use the default vault
+		if code, ok := runWithoutVault(settings, args[0], args[1:]...); ok {
+			return code
 		}
-	} else if stat.IsDir() {
-		fmt.Println("File is a directory")
-		return
-	} else {
-		fmt.Println("Enter pass phrase:")
-		password, err := terminal.ReadPassword(0)
-		if err != nil {
-			fmt.Printf("Error reading password: %v\n", err)
-			return
+		if settings.Vault == "" {
+			return fail(exitUsage, "No vault path given and no default vault configured, see safe help config")
+		}
+		args = append([]string{settings.Vault}, args...)
+	}
+	if len(args) < 2 {
+		return usageError(usage)
+	}
+	path, command, params := args[0], args[1], args[2:]
+	if _, ok := help[command]; !ok {
+		if options.json {
+			return fail(exitUsage, "Unknown command %v", command)
 		}
-		safe = vault.OpenVaultFromPassword([]byte(password), os.Args[1])
-		if safe == nil {
-			fmt.Println("Could not open vault")
-			return
+		fmt.Printf("Unknown command %v\n\n", command)
+		fmt.Print(usage)
+		return exitUsage
+	}
+	if code, ok := runWithoutVault(settings, command, params...); ok {
+		return code
+	}
+	if command == "recover" || command == "restore" {
+		return recoverVault(path, command, params...)
+	}
+	safe, code := openOrCreate(path)
+	if safe == nil {
+		return code
+	}
+	defer safe.Close()
+	switch command {
+	case "new":
+		return newKey(safe, params...)
+	case "list":
+		return list(safe, params...)
+	case "retire":
+		return retire(safe, params...)
+	case "compact":
+		return compact(safe)
+	case "export":
+		return exportBundle(safe, params...)
+	case "import":
+		return importBundle(safe, params...)
+	case "mnemonic":
+		return printMnemonic(safe)
+	case "derive":
+		return derive(safe, params...)
+	case "agent":
+		return serveAgent(safe, path, params...)
+	case "balance":
+		return balance(safe, settings, params...)
+	case "send":
+		return send(safe, settings, params...)
+	case "deposit":
+		return deposit(safe, settings, params...)
+	case "withdraw":
+		return withdraw(safe, settings, params...)
+	case "grant":
+		return grant(safe, settings, params...)
+	case "revoke":
+		return revoke(safe, settings, params...)
+	case "attorneys":
+		return listAttorneys(safe, settings, params...)
+	case "sign":
+		return signMessage(safe, params...)
+	case "sign-action":
+		return signAction(safe, params...)
+	}
+	return exitOK
+}
+
+// runWithoutVault runs the commands that do not need a vault. ok is false for
+// any other command.
+func runWithoutVault(settings *Settings, command string, params ...string) (code int, ok bool) {
+	switch command {
+	case "config":
+		return configure(settings, params...), true
+	case "verify":
+		return verifyMessage(params...), true
+	case "prepare":
+		return prepare(settings, params...), true
+	case "submit":
+		return submitEnvelope(settings, params...), true
+	}
+	return exitOK, false
+}
+
+// openOrCreate opens the vault file at path, or offers to create it if it
+// does not exist.
+func openOrCreate(path string) (*vault.SecureVault, int) {
+	stat, _ := os.Stat(path)
+	if stat == nil {
+		if !confirm("File does not exist. Create new") {
+			return nil, exitFailure
+		}
+		password, ok := readPassphrase("Enter pass phrase to secure safe vault:")
+		if !ok {
+			return nil, exitFailure
+		}
+		safe, err := vault.CreateSecureVault(password, path)
+		if err != nil {
+			return nil, fail(exitFailure, "Could not create vault: %v", err)
 		}
+		return safe, exitOK
+	}
+	if stat.IsDir() {
+		return nil, fail(exitFailure, "File is a directory")
+	}
+	password, ok := readPassphrase("Enter pass phrase:")
+	if !ok {
+		return nil, exitFailure
+	}
+	safe, err := vault.OpenSecureVault(password, path)
+	if errors.Is(err, vault.ErrWrongPassphrase) {
+		return nil, fail(exitFailure, "Wrong pass phrase")
+	} else if err != nil {
+		return nil, fail(exitFailure, "Could not open vault: %v", err)
+	}
+	if safe.Repaired() {
+		notice("Incomplete record removed from vault and saved to %v.torn\n", path)
 	}
+	return safe, exitOK
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"os"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/cb/vault"
+)
+
+// messagePrefix is signed ahead of every message, so that a message signature
+// can never be taken for the signature of a network action.
+const messagePrefix = "cb signed message:\n"
+
+// signedMessage is the message with the message prefix.
+func signedMessage(message []byte) []byte {
+	return append([]byte(messagePrefix), message...)
+}
+
+// readMessage reads the message to sign or verify from a file, or from stdin
+// if path is -.
+func readMessage(path string) ([]byte, bool) {
+	var message []byte
+	var err error
+	if path == "-" {
+		message, err = io.ReadAll(os.Stdin)
+	} else {
+		message, err = os.ReadFile(path)
+	}
+	if err != nil {
+		printError("Could not read message: %v", err)
+		return nil, false
+	}
+	return message, true
+}
+
+// parseSignature accepts a signature encoded in hex or in base64.
+func parseSignature(text string) (crypto.Signature, bool) {
+	var signature crypto.Signature
+	bytes, err := hex.DecodeString(text)
+	if err != nil {
+		if bytes, err = base64.StdEncoding.DecodeString(text); err != nil {
+			return signature, false
+		}
+	}
+	if len(bytes) != len(signature) {
+		return signature, false
+	}
+	copy(signature[:], bytes)
+	return signature, true
+}
+
+func signMessage(safe *vault.SecureVault, args ...string) int {
+	if len(args) != 2 && len(args) != 3 {
+		return usageError(helpSign)
+	}
+	encode := hex.EncodeToString
+	if len(args) == 3 {
+		switch args[2] {
+		case "hex":
+		case "base64":
+			encode = base64.StdEncoding.EncodeToString
+		default:
+			return usageError(helpSign)
+		}
+	}
+	key, ok := walletKey(safe, args[0])
+	if !ok {
+		return exitFailure
+	}
+	message, ok := readMessage(args[1])
+	if !ok {
+		return exitFailure
+	}
+	token := key.PublicKey()
+	signature := key.Sign(signedMessage(message))
+	encoded := encode(signature[:])
+	report(map[string]string{"token": hex.EncodeToString(token[:]), "signature": encoded}, "%v\n", encoded)
+	return exitOK
+}
+
+// verifyMessage runs the verify command. It does not need a vault.
+func verifyMessage(args ...string) int {
+	if len(args) != 3 {
+		return usageError(helpVerify)
+	}
+	token, ok := parseToken(args[0])
+	if !ok {
+		return fail(exitUsage, "Invalid token %v", args[0])
+	}
+	signature, ok := parseSignature(args[1])
+	if !ok {
+		return fail(exitUsage, "Invalid signature %v", args[1])
+	}
+	message, ok := readMessage(args[2])
+	if !ok {
+		return exitFailure
+	}
+	if !token.Verify(signedMessage(message), signature) {
+		report(map[string]bool{"valid": false}, "Invalid signature\n")
+		return exitFailure
+	}
+	report(map[string]bool{"valid": true}, "Valid signature\n")
+	return exitOK
+}
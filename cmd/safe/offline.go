@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/freehandle/axe/attorney"
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/actions"
+	"github.com/freehandle/cb/topos"
+	"github.com/freehandle/cb/vault"
+)
+
+// prepare writes an unsigned action of author to a request file. The action
+// is built for the current epoch, so it needs the relay but not the vault.
+func prepare(settings *Settings, args ...string) int {
+	if len(args) < 3 {
+		return usageError(helpPrepare)
+	}
+	path, action, author, params := args[0], args[1], args[2], args[3:]
+	from, ok := parseToken(author)
+	if !ok {
+		return fail(exitUsage, "Invalid token %v", author)
+	}
+	envelope := topos.Envelope{Kind: topos.EnvelopeBreeze, Signer: from, Fee: settings.Fee}
+	var cost, deposited uint64
+	var build func(epoch uint64) []byte
+	switch action {
+	case "send":
+		if len(params) != 2 && len(params) != 3 {
+			return usageError(helpPrepare)
+		}
+		to, ok := parseToken(params[0])
+		if !ok {
+			return fail(exitUsage, "Invalid token %v", params[0])
+		}
+		amount, ok := parseAmount(params[1])
+		if !ok {
+			return exitUsage
+		}
+		reason := ""
+		if len(params) == 3 {
+			reason = params[2]
+		}
+		cost = amount + settings.Fee
+		build = func(epoch uint64) []byte {
+			transfer := actions.Transfer{
+				TimeStamp: epoch,
+				From:      from,
+				To:        []crypto.TokenValue{{Token: to, Value: amount}},
+				Reason:    reason,
+				Fee:       settings.Fee,
+			}
+			return transfer.Serialize()
+		}
+	case "deposit", "withdraw":
+		if len(params) != 1 {
+			return usageError(helpPrepare)
+		}
+		amount, ok := parseAmount(params[0])
+		if !ok {
+			return exitUsage
+		}
+		if action == "deposit" {
+			cost = amount + settings.Fee
+			build = func(epoch uint64) []byte {
+				deposit := actions.Deposit{TimeStamp: epoch, Token: from, Value: amount, Fee: settings.Fee}
+				return deposit.Serialize()
+			}
+		} else {
+			cost, deposited = withdrawCost(amount, settings.Fee), amount
+			build = func(epoch uint64) []byte {
+				withdraw := actions.Withdraw{TimeStamp: epoch, Token: from, Value: amount, Fee: settings.Fee}
+				return withdraw.Serialize()
+			}
+		}
+	case "grant", "revoke":
+		if len(params) != 1 {
+			return usageError(helpPrepare)
+		}
+		token, ok := parseToken(params[0])
+		if !ok {
+			return fail(exitUsage, "Invalid token %v", params[0])
+		}
+		envelope.Kind = topos.EnvelopeAxe
+		cost = settings.Fee
+		if action == "grant" {
+			build = func(epoch uint64) []byte {
+				grant := attorney.GrantPowerOfAttorney{Epoch: epoch, Author: from, Attorney: token}
+				return grant.Serialize()
+			}
+		} else {
+			build = func(epoch uint64) []byte {
+				revoke := attorney.RevokePowerOfAttorney{Epoch: epoch, Author: from, Attorney: token}
+				return revoke.Serialize()
+			}
+		}
+	default:
+		return usageError(helpPrepare)
+	}
+	epoch, ok := fundedEpoch(settings, from, cost, deposited)
+	if !ok {
+		return exitFailure
+	}
+	envelope.Action = build(epoch)
+	if err := os.WriteFile(path, envelope.Serialize(), 0600); err != nil {
+		return fail(exitFailure, "Could not write request file: %v", err)
+	}
+	report(map[string]any{"request": path, "epoch": epoch}, "Unsigned %v for epoch %v written to %v\n", action, epoch, path)
+	return exitOK
+}
+
+func readEnvelope(path string) (*topos.Envelope, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		printError("Could not read %v: %v", path, err)
+		return nil, false
+	}
+	envelope, err := topos.ParseEnvelope(data)
+	if err != nil {
+		printError("Could not read %v: %v", path, err)
+		return nil, false
+	}
+	return envelope, true
+}
+
+// describe tells what the action of an envelope does, for the holder of the
+// key to check before signing it.
+func describe(envelope *topos.Envelope) string {
+	if envelope.Kind == topos.EnvelopeAxe {
+		if grant := attorney.ParseGrantPowerOfAttorney(envelope.Action); grant != nil {
+			return fmt.Sprintf("grant power of attorney to %v on epoch %v", hex.EncodeToString(grant.Attorney[:]), grant.Epoch)
+		}
+		if revoke := attorney.ParseRevokePowerOfAttorney(envelope.Action); revoke != nil {
+			return fmt.Sprintf("revoke power of attorney of %v on epoch %v", hex.EncodeToString(revoke.Attorney[:]), revoke.Epoch)
+		}
+		return "unknown axe action"
+	}
+	switch actions.Kind(envelope.Action) {
+	case actions.ITransfer:
+		if transfer := actions.ParseTransfer(envelope.Action); transfer != nil {
+			text := fmt.Sprintf("transfer on epoch %v with fee %v", transfer.TimeStamp, transfer.Fee)
+			for _, to := range transfer.To {
+				text = fmt.Sprintf("%v\n  %v to %v", text, to.Value, hex.EncodeToString(to.Token[:]))
+			}
+			return text
+		}
+	case actions.IDeposit:
+		if deposit := actions.ParseDeposit(envelope.Action); deposit != nil {
+			return fmt.Sprintf("deposit of %v on epoch %v with fee %v", deposit.Value, deposit.TimeStamp, deposit.Fee)
+		}
+	case actions.IWithdraw:
+		if withdraw := actions.ParseWithdraw(envelope.Action); withdraw != nil {
+			return fmt.Sprintf("withdraw of %v on epoch %v with fee %v", withdraw.Value, withdraw.TimeStamp, withdraw.Fee)
+		}
+	}
+	return "unknown breeze action"
+}
+
+func signAction(safe *vault.SecureVault, args ...string) int {
+	if len(args) != 1 && len(args) != 2 {
+		return usageError(helpSignAction)
+	}
+	envelope, ok := readEnvelope(args[0])
+	if !ok {
+		return exitFailure
+	}
+	if len(envelope.Signed) > 0 {
+		return fail(exitFailure, "Action is already signed")
+	}
+	key, ok := walletKey(safe, hex.EncodeToString(envelope.Signer[:]))
+	if !ok {
+		return exitFailure
+	}
+	notice("Signer %v\n%v\n", hex.EncodeToString(envelope.Signer[:]), describe(envelope))
+	if envelope.Kind == topos.EnvelopeAxe {
+		notice("dressed for breeze with fee %v\n", envelope.Fee)
+	}
+	if !confirm("Sign action") {
+		return exitFailure
+	}
+	if err := envelope.Sign(key); err != nil {
+		return fail(exitFailure, "Could not sign action: %v", err)
+	}
+	path := args[0]
+	if len(args) == 2 {
+		path = args[1]
+	}
+	if err := os.WriteFile(path, envelope.Serialize(), 0600); err != nil {
+		return fail(exitFailure, "Could not write signed file: %v", err)
+	}
+	report(map[string]string{"signed": path}, "Signed action written to %v\n", path)
+	return exitOK
+}
+
+func submitEnvelope(settings *Settings, args ...string) int {
+	if len(args) != 1 {
+		return usageError(helpSubmit)
+	}
+	envelope, ok := readEnvelope(args[0])
+	if !ok {
+		return exitFailure
+	}
+	if len(envelope.Signed) == 0 {
+		return fail(exitFailure, "Action is not signed, see safe help sign-action")
+	}
+	return submitAction(settings, envelope.Signed)
+}
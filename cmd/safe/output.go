@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// options are the global flags of the safe command. They come before the
+// vault path.
+var options struct {
+	passphraseFd   int
+	passphraseFile string
+	passphraseEnv  string
+	yes            bool
+	json           bool
+}
+
+// passphrases given by a non-interactive source, one per line, in the order
+// they are asked for. nil while not read.
+var passphrases []string
+
+func parseOptions(args []string) ([]string, bool) {
+	flags := flag.NewFlagSet("safe", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flags.IntVar(&options.passphraseFd, "passphrase-fd", -1, "read pass phrases from file descriptor")
+	flags.StringVar(&options.passphraseFile, "passphrase-file", "", "read pass phrases from file")
+	flags.StringVar(&options.passphraseEnv, "passphrase-env", "", "read pass phrases from environment variable")
+	flags.BoolVar(&options.yes, "yes", false, "create the vault file without asking")
+	flags.BoolVar(&options.json, "json", false, "print results as JSON")
+	if err := flags.Parse(args); err != nil {
+		return nil, false
+	}
+	sources := 0
+	for _, given := range []bool{options.passphraseFd >= 0, options.passphraseFile != "", options.passphraseEnv != ""} {
+		if given {
+			sources++
+		}
+	}
+	if sources > 1 {
+		fmt.Fprintln(os.Stderr, "Only one pass phrase source can be given")
+		return nil, false
+	}
+	return flags.Args(), true
+}
+
+func interactive() bool {
+	return options.passphraseFd < 0 && options.passphraseFile == "" && options.passphraseEnv == ""
+}
+
+// loadPassphrases reads every pass phrase of the non-interactive source.
+func loadPassphrases() error {
+	var data []byte
+	var err error
+	switch {
+	case options.passphraseFd >= 0:
+		file := os.NewFile(uintptr(options.passphraseFd), "passphrase-fd")
+		if file == nil {
+			return fmt.Errorf("invalid file descriptor %v", options.passphraseFd)
+		}
+		data, err = io.ReadAll(file)
+		file.Close()
+	case options.passphraseFile != "":
+		data, err = os.ReadFile(options.passphraseFile)
+	default:
+		value, ok := os.LookupEnv(options.passphraseEnv)
+		if !ok {
+			return fmt.Errorf("environment variable %v not set", options.passphraseEnv)
+		}
+		data = []byte(value)
+	}
+	if err != nil {
+		return fmt.Errorf("could not read pass phrases: %v", err)
+	}
+	passphrases = strings.Split(strings.TrimRight(string(data), "\r\n"), "\n")
+	return nil
+}
+
+func readPassphrase(prompt string) ([]byte, bool) {
+	if interactive() {
+		fmt.Fprintln(os.Stderr, prompt)
+		password, err := terminal.ReadPassword(0)
+		if err != nil {
+			printError("Error reading password: %v", err)
+			return nil, false
+		}
+		return password, true
+	}
+	if passphrases == nil {
+		if err := loadPassphrases(); err != nil {
+			printError("%v", err)
+			return nil, false
+		}
+	}
+	if len(passphrases) == 0 {
+		printError("No pass phrase left for: %v", prompt)
+		return nil, false
+	}
+	password := strings.TrimSuffix(passphrases[0], "\r")
+	passphrases = passphrases[1:]
+	return []byte(password), true
+}
+
+// confirm asks a yes or no question, answered yes by the --yes flag.
+func confirm(question string) bool {
+	if options.yes {
+		return true
+	}
+	fmt.Fprintf(os.Stderr, "%v [yes/no]?", question)
+	var yes string
+	fmt.Scan(&yes)
+	yes = strings.TrimSpace(strings.ToLower(yes))
+	return yes == "yes" || yes == "y"
+}
+
+// report prints the result of a command: the JSON encoding of value with the
+// --json flag, or the formatted text otherwise.
+func report(value any, format string, args ...any) {
+	if options.json {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(value)
+		return
+	}
+	fmt.Printf(format, args...)
+}
+
+// notice prints a message that is not the result of a command. It goes to
+// stderr with the --json flag.
+func notice(format string, args ...any) {
+	if options.json {
+		fmt.Fprintf(os.Stderr, format, args...)
+		return
+	}
+	fmt.Printf(format, args...)
+}
+
+func printError(format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	if options.json {
+		report(map[string]string{"error": message}, "")
+		return
+	}
+	fmt.Println(message)
+}
+
+// fail reports an error and returns the exit code of the command.
+func fail(code int, format string, args ...any) int {
+	printError(format, args...)
+	return code
+}
+
+// usageError shows the help text of a command called with wrong arguments.
+func usageError(help string) int {
+	if options.json {
+		fmt.Fprint(os.Stderr, help)
+		return fail(exitUsage, "invalid arguments")
+	}
+	fmt.Print(help)
+	return exitUsage
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/freehandle/breeze/crypto"
+	util "github.com/freehandle/cb/config"
+)
+
+const (
+	settingsFolder = ".safe"
+	settingsFile   = "config.json"
+)
+
+// Settings is the global configuration of the safe command, kept on the home
+// directory of the user.
+type Settings struct {
+	Vault          string // vault file used when no path is given
+	GatewayAddress string // topos gateway receiving actions
+	GatewayToken   string
+	RelayAddress   string // relay or index node answering balance requests
+	RelayToken     string
+	AxeAddress     string // axe validator node answering attorney queries
+	AxeToken       string
+	Fee            uint64 // fee offered on every action
+}
+
+// setting is a key of the settings file editable with safe config.
+type setting struct {
+	get func(s *Settings) string
+	set func(s *Settings, value string) error
+}
+
+func textSetting(field func(s *Settings) *string) setting {
+	return setting{
+		get: func(s *Settings) string { return *field(s) },
+		set: func(s *Settings, value string) error {
+			*field(s) = value
+			return nil
+		},
+	}
+}
+
+func tokenSetting(field func(s *Settings) *string) setting {
+	return setting{
+		get: func(s *Settings) string { return *field(s) },
+		set: func(s *Settings, value string) error {
+			if _, ok := parseToken(value); !ok && value != "" {
+				return fmt.Errorf("invalid token %v", value)
+			}
+			*field(s) = value
+			return nil
+		},
+	}
+}
+
+var settingKeys = map[string]setting{
+	"vault":         textSetting(func(s *Settings) *string { return &s.Vault }),
+	"gateway":       textSetting(func(s *Settings) *string { return &s.GatewayAddress }),
+	"gateway-token": tokenSetting(func(s *Settings) *string { return &s.GatewayToken }),
+	"relay":         textSetting(func(s *Settings) *string { return &s.RelayAddress }),
+	"relay-token":   tokenSetting(func(s *Settings) *string { return &s.RelayToken }),
+	"axe":           textSetting(func(s *Settings) *string { return &s.AxeAddress }),
+	"axe-token":     tokenSetting(func(s *Settings) *string { return &s.AxeToken }),
+	"fee": {
+		get: func(s *Settings) string { return strconv.FormatUint(s.Fee, 10) },
+		set: func(s *Settings, value string) error {
+			fee, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid fee %v", value)
+			}
+			s.Fee = fee
+			return nil
+		},
+	},
+}
+
+func settingsPath() string {
+	return filepath.Join(util.DefaultHomeDir(), settingsFolder, settingsFile)
+}
+
+// loadSettings reads the settings file. Settings are empty if the file does
+// not exist; it is only created on Save.
+func loadSettings() (*Settings, error) {
+	var settings Settings
+	data, err := os.ReadFile(settingsPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return &settings, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read settings: %v", err)
+	}
+	if len(data) == 0 {
+		return &settings, nil
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("could not parse settings file %v: %v", settingsPath(), err)
+	}
+	return &settings, nil
+}
+
+// Save writes the settings to a temporary file readable only by the user and
+// renames it over the settings file, so that a failed write never leaves it
+// partial.
+func (s *Settings) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not serialize settings: %v", err)
+	}
+	path := settingsPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("could not create settings folder: %v", err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), settingsFile+".*")
+	if err != nil {
+		return fmt.Errorf("could not write settings: %v", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("could not write settings: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("could not write settings: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("could not write settings: %v", err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("could not write settings: %v", err)
+	}
+	return nil
+}
+
+// node returns the address and token of a configured node.
+func (s *Settings) node(name, address, token string) (string, crypto.Token, error) {
+	if address == "" || token == "" {
+		return "", crypto.Token{}, fmt.Errorf("%v not configured, see safe help config", name)
+	}
+	parsed, ok := parseToken(token)
+	if !ok {
+		return "", crypto.Token{}, fmt.Errorf("invalid %v token on settings", name)
+	}
+	return address, parsed, nil
+}
+
+func (s *Settings) Gateway() (string, crypto.Token, error) {
+	return s.node("gateway", s.GatewayAddress, s.GatewayToken)
+}
+
+func (s *Settings) Relay() (string, crypto.Token, error) {
+	return s.node("relay", s.RelayAddress, s.RelayToken)
+}
+
+func (s *Settings) Axe() (string, crypto.Token, error) {
+	return s.node("axe node", s.AxeAddress, s.AxeToken)
+}
+
+func parseToken(text string) (crypto.Token, bool) {
+	bytes, err := hex.DecodeString(text)
+	if err != nil || len(bytes) != len(crypto.Token{}) {
+		return crypto.Token{}, false
+	}
+	var token crypto.Token
+	copy(token[:], bytes)
+	return token, true
+}
+
+// configure runs the safe config command.
+func configure(current *Settings, args ...string) int {
+	if len(args) == 0 {
+		return usageError(helpConfig)
+	}
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return usageError(helpConfig)
+		}
+		keys := make([]string, 0, len(settingKeys))
+		for key := range settingKeys {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if options.json {
+			values := make(map[string]string)
+			for _, key := range keys {
+				values[key] = settingKeys[key].get(current)
+			}
+			report(values, "")
+			return exitOK
+		}
+		for _, key := range keys {
+			fmt.Printf("%-14v %v\n", key, settingKeys[key].get(current))
+		}
+		return exitOK
+	case "get":
+		if len(args) != 2 {
+			return usageError(helpConfig)
+		}
+		setting, ok := settingKeys[args[1]]
+		if !ok {
+			return fail(exitUsage, "Unknown setting %v", args[1])
+		}
+		report(map[string]string{args[1]: setting.get(current)}, "%v\n", setting.get(current))
+		return exitOK
+	case "set":
+		if len(args) != 3 {
+			return usageError(helpConfig)
+		}
+		setting, ok := settingKeys[args[1]]
+		if !ok {
+			return fail(exitUsage, "Unknown setting %v", args[1])
+		}
+		if err := setting.set(current, args[2]); err != nil {
+			return fail(exitUsage, "%v", err)
+		}
+		if err := current.Save(); err != nil {
+			return fail(exitFailure, "%v", err)
+		}
+		if options.json {
+			report(map[string]string{args[1]: setting.get(current)}, "")
+		}
+		return exitOK
+	}
+	return usageError(helpConfig)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/hex"
+	"strconv"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/actions"
+	"github.com/freehandle/cb/topos"
+	"github.com/freehandle/cb/vault"
+)
+
+// walletKey resolves the private key of a vault entry by label or token.
+func walletKey(safe *vault.SecureVault, labelOrToken string) (crypto.PrivateKey, bool) {
+	token, ok := findToken(safe, labelOrToken)
+	if !ok {
+		printError("Key %v not found on vault", labelOrToken)
+		return crypto.PrivateKey{}, false
+	}
+	entry, _ := safe.EntryByToken(token)
+	return entry.Key, true
+}
+
+func parseAmount(text string) (uint64, bool) {
+	amount, err := strconv.ParseUint(text, 10, 64)
+	if err != nil || amount == 0 {
+		printError("Invalid amount %v", text)
+		return 0, false
+	}
+	return amount, true
+}
+
+// requestBalance asks the configured relay for the balance of token. The
+// connection is authenticated by an ephemeral key.
+func requestBalance(settings *Settings, token crypto.Token) (*topos.Balance, bool) {
+	address, node, err := settings.Relay()
+	if err != nil {
+		printError("%v", err)
+		return nil, false
+	}
+	_, ephemeral := crypto.RandomAsymetricKey()
+	balance, err := topos.RequestBalance(address, node, ephemeral, token)
+	if err != nil {
+		printError("Could not get balance: %v", err)
+		return nil, false
+	}
+	return balance, true
+}
+
+// fundedEpoch checks that the wallet of token can pay cost and its deposit
+// covers deposit, and returns the current epoch.
+func fundedEpoch(settings *Settings, token crypto.Token, cost, deposit uint64) (uint64, bool) {
+	balance, ok := requestBalance(settings, token)
+	if !ok {
+		return 0, false
+	}
+	if balance.Wallet < cost {
+		printError("Insufficient funds: wallet balance is %v", balance.Wallet)
+		return 0, false
+	}
+	if balance.Deposit < deposit {
+		printError("Insufficient deposit: deposit balance is %v", balance.Deposit)
+		return 0, false
+	}
+	return balance.Epoch, true
+}
+
+// withdrawCost is what the wallet must hold for a withdraw of amount with fee,
+// which is paid from the withdrawn amount first.
+func withdrawCost(amount, fee uint64) uint64 {
+	if fee > amount {
+		return fee - amount
+	}
+	return 0
+}
+
+// submitAction sends a signed action to the configured gateway.
+func submitAction(settings *Settings, action []byte) int {
+	address, gateway, err := settings.Gateway()
+	if err != nil {
+		return fail(exitFailure, "%v", err)
+	}
+	_, ephemeral := crypto.RandomAsymetricKey()
+	if err := topos.SubmitAction(address, gateway, ephemeral, action); err != nil {
+		return fail(exitFailure, "%v", err)
+	}
+	report(map[string]bool{"submitted": true}, "Action submitted\n")
+	return exitOK
+}
+
+// submit checks that the wallet of token can pay cost and its deposit covers
+// deposit, and sends the action built for the current epoch to the configured
+// gateway.
+func submit(settings *Settings, token crypto.Token, cost, deposit uint64, build func(epoch uint64) []byte) int {
+	if _, _, err := settings.Gateway(); err != nil {
+		return fail(exitFailure, "%v", err)
+	}
+	epoch, ok := fundedEpoch(settings, token, cost, deposit)
+	if !ok {
+		return exitFailure
+	}
+	return submitAction(settings, build(epoch))
+}
+
+func balance(safe *vault.SecureVault, settings *Settings, args ...string) int {
+	if len(args) != 1 {
+		return usageError(helpBalance)
+	}
+	token, ok := findToken(safe, args[0])
+	if !ok {
+		if token, ok = parseToken(args[0]); !ok {
+			return fail(exitFailure, "Key %v not found on vault", args[0])
+		}
+	}
+	balance, ok := requestBalance(settings, token)
+	if !ok {
+		return exitFailure
+	}
+	result := map[string]any{
+		"token":   hex.EncodeToString(token[:]),
+		"wallet":  balance.Wallet,
+		"deposit": balance.Deposit,
+		"epoch":   balance.Epoch,
+	}
+	report(result, "wallet:  %v\ndeposit: %v\nepoch:   %v\n", balance.Wallet, balance.Deposit, balance.Epoch)
+	return exitOK
+}
+
+func send(safe *vault.SecureVault, settings *Settings, args ...string) int {
+	if len(args) != 3 && len(args) != 4 {
+		return usageError(helpSend)
+	}
+	key, ok := walletKey(safe, args[0])
+	if !ok {
+		return exitFailure
+	}
+	to, ok := parseToken(args[1])
+	if !ok {
+		return fail(exitUsage, "Invalid token %v", args[1])
+	}
+	amount, ok := parseAmount(args[2])
+	if !ok {
+		return exitUsage
+	}
+	reason := ""
+	if len(args) == 4 {
+		reason = args[3]
+	}
+	return submit(settings, key.PublicKey(), amount+settings.Fee, 0, func(epoch uint64) []byte {
+		transfer := actions.Transfer{
+			TimeStamp: epoch,
+			From:      key.PublicKey(),
+			To:        []crypto.TokenValue{{Token: to, Value: amount}},
+			Reason:    reason,
+			Fee:       settings.Fee,
+		}
+		transfer.Sign(key)
+		return transfer.Serialize()
+	})
+}
+
+func deposit(safe *vault.SecureVault, settings *Settings, args ...string) int {
+	if len(args) != 2 {
+		return usageError(helpDeposit)
+	}
+	key, ok := walletKey(safe, args[0])
+	if !ok {
+		return exitFailure
+	}
+	amount, ok := parseAmount(args[1])
+	if !ok {
+		return exitUsage
+	}
+	return submit(settings, key.PublicKey(), amount+settings.Fee, 0, func(epoch uint64) []byte {
+		deposit := actions.Deposit{
+			TimeStamp: epoch,
+			Token:     key.PublicKey(),
+			Value:     amount,
+			Fee:       settings.Fee,
+		}
+		deposit.Sign(key)
+		return deposit.Serialize()
+	})
+}
+
+func withdraw(safe *vault.SecureVault, settings *Settings, args ...string) int {
+	if len(args) != 2 {
+		return usageError(helpWithdraw)
+	}
+	key, ok := walletKey(safe, args[0])
+	if !ok {
+		return exitFailure
+	}
+	amount, ok := parseAmount(args[1])
+	if !ok {
+		return exitUsage
+	}
+	return submit(settings, key.PublicKey(), withdrawCost(amount, settings.Fee), amount, func(epoch uint64) []byte {
+		withdraw := actions.Withdraw{
+			TimeStamp: epoch,
+			Token:     key.PublicKey(),
+			Value:     amount,
+			Fee:       settings.Fee,
+		}
+		withdraw.Sign(key)
+		return withdraw.Serialize()
+	})
+}
@@ -25,23 +25,36 @@ func vaultExists(vaultpath string) bool {
 	return !info.IsDir()
 }
 
-func GetOrSetCredentialsFromVault(vaultpath string) (crypto.PrivateKey, string) {
+// GetOrSetCredentialsFromVault returns the secret key of the vault file at
+// vaultpath, creating the vault if it does not exist. For a new vault it also
+// returns a notice with its token.
+func GetOrSetCredentialsFromVault(vaultpath string) (crypto.PrivateKey, string, error) {
 	if vaultExists(vaultpath) {
 		fmt.Print("Enter passphrase of secure vault:")
-		bytePassword, _ := term.ReadPassword(int(syscall.Stdin))
-		secrets := vault.OpenVaultFromPassword(bytePassword, vaultpath)
-		secrets.Close()
-		credentials := secrets.SecretKey
-		return credentials, ""
-	} else {
-		fmt.Print("Enter passphrase for a new secure vault:")
 		bytePassword, err := term.ReadPassword(int(syscall.Stdin))
 		if err != nil {
-			log.Fatalf("could not read password: %v", err)
+			return crypto.PrivateKey{}, "", fmt.Errorf("could not read password: %v", err)
+		}
+		secrets, err := vault.OpenSecureVault(bytePassword, vaultpath)
+		if err != nil {
+			return crypto.PrivateKey{}, "", fmt.Errorf("could not open secure vault: %v", err)
 		}
-		secrets := vault.NewSecureVault(bytePassword, vaultpath)
-		return secrets.SecretKey, fmt.Sprintf("Token %v generated for vault %v\nUpdate your config file.\n", secrets.SecretKey.PublicKey(), vaultpath)
+		credentials := secrets.SecretKey
+		secrets.Close()
+		return credentials, "", nil
 	}
+	fmt.Print("Enter passphrase for a new secure vault:")
+	bytePassword, err := term.ReadPassword(int(syscall.Stdin))
+	if err != nil {
+		return crypto.PrivateKey{}, "", fmt.Errorf("could not read password: %v", err)
+	}
+	secrets, err := vault.CreateSecureVault(bytePassword, vaultpath)
+	if err != nil {
+		return crypto.PrivateKey{}, "", fmt.Errorf("could not create secure vault: %v", err)
+	}
+	credentials := secrets.SecretKey
+	secrets.Close()
+	return credentials, fmt.Sprintf("Token %v generated for vault %v\nUpdate your config file.\n", credentials.PublicKey(), vaultpath), nil
 }
 
 func ReadConfigFile(configpath string, config any) {
@@ -54,16 +67,12 @@ func ReadConfigFile(configpath string, config any) {
 	}
 }
 
-func ShutdownEvents() chan struct{} {
-	c := make(chan os.Signal, 1) // we need to reserve to buffer size 1, so the notifier are not blocked
+// ShutdownEvents signals every interrupt or terminate signal. Commands shut
+// down in order on the first one and decide what further ones mean.
+func ShutdownEvents() chan os.Signal {
+	c := make(chan os.Signal, 2) // we need to reserve buffer, so the notifier are not blocked
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	done := make(chan struct{})
-	go func() {
-		<-c
-		log.Print("shuting down")
-		done <- struct{}{}
-	}()
-	return done
+	return c
 }
 
 func AskConfirm(text string) bool {
@@ -133,24 +142,50 @@ func FileExists(filePath string) bool {
 	return !info.IsDir()
 }
 
-func OpenVault(path string) *vault.SecureVault {
+func readPassword() ([]byte, error) {
 	fmt.Printf("secret password: ")
 	passwd, err := term.ReadPassword(int(syscall.Stdin))
 	fmt.Println("")
 	if err != nil {
-		log.Fatalf("could not read password: %v", err)
+		return nil, fmt.Errorf("could not read password: %v", err)
+	}
+	return passwd, nil
+}
+
+// OpenExistingVault asks for the password of the vault file at path and opens
+// it. It fails without asking if there is no vault file at path.
+func OpenExistingVault(path string) (*vault.SecureVault, error) {
+	if !FileExists(path) {
+		return nil, fmt.Errorf("no vault file at %v", path)
+	}
+	passwd, err := readPassword()
+	if err != nil {
+		return nil, err
+	}
+	opened, err := vault.OpenSecureVault(passwd, path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open secure vault: %v", err)
+	}
+	return opened, nil
+}
+
+// OpenVault asks for the password of the vault file at path and opens it,
+// creating the vault if it does not exist.
+func OpenVault(path string) (*vault.SecureVault, error) {
+	passwd, err := readPassword()
+	if err != nil {
+		return nil, err
 	}
-	var opened *vault.SecureVault
 	if FileExists(path) {
-		opened = vault.OpenVaultFromPassword(passwd, path)
-		if opened == nil {
-			log.Fatal("could not open secure vault")
+		opened, err := vault.OpenSecureVault(passwd, path)
+		if err != nil {
+			return nil, fmt.Errorf("could not open secure vault: %v", err)
 		}
-		return opened
+		return opened, nil
 	}
-	opened = vault.NewSecureVault(passwd, path)
-	if opened == nil {
-		log.Fatal("could not create secure vault")
+	opened, err := vault.CreateSecureVault(passwd, path)
+	if err != nil {
+		return nil, fmt.Errorf("could not create secure vault: %v", err)
 	}
-	return opened
+	return opened, nil
 }
@@ -0,0 +1,251 @@
+// Package harness runs a cb network in process for integration tests. Every
+// node listens on an ephemeral port, so that tests can run in parallel.
+//
+// The network is a single authority node standing in for breeze, a gateway
+// forwarding actions to it, and a relay, an index db and an axe protocol
+// validator following its blocks. The validator follows the authority with
+// topos.SingleAuthorityListener, as it does not speak the breeze block
+// protocol.
+package harness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/freehandle/axe/attorney"
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/socket"
+	"github.com/freehandle/cb/attorneys"
+	"github.com/freehandle/cb/index"
+	"github.com/freehandle/cb/social"
+	"github.com/freehandle/cb/topos"
+	"github.com/freehandle/papirus"
+)
+
+type Config struct {
+	Dir           string                  // directory for the chain files
+	BlockInterval time.Duration           // 100ms if zero
+	KeepBlocks    int                     // blocks kept by the authority, 100 if zero
+	Genesis       map[crypto.Token]uint64 // initial wallet balances
+	Fee           uint64                  // fee paid by the gateway to dress void actions
+}
+
+// Network is a running in process network. Nodes are keyed by token on the
+// connection pools of the nodes they follow, so every node has a key of its
+// own.
+type Network struct {
+	Credentials crypto.PrivateKey // of the client submitting and observing
+	Keys        NodeKeys
+	Authority   *topos.SingleAuthority
+	Gateway     *social.Handle
+	Relay       *social.Handle
+	Index       *social.Handle
+	Validator   *social.Handle
+}
+
+// NodeKeys are the secret keys of the nodes of a network.
+type NodeKeys struct {
+	Authority crypto.PrivateKey
+	Gateway   crypto.PrivateKey
+	Relay     crypto.PrivateKey
+	Index     crypto.PrivateKey
+	Validator crypto.PrivateKey
+}
+
+func newKey() crypto.PrivateKey {
+	_, key := crypto.RandomAsymetricKey()
+	return key
+}
+
+// Address is the local address to dial a node listening on addr.
+func Address(addr net.Addr) string {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return fmt.Sprintf("localhost:%v", tcp.Port)
+	}
+	return addr.String()
+}
+
+// Start launches the nodes of the network with ctx. If a node cannot be
+// started, the ones already running are closed.
+func Start(ctx context.Context, config Config) (*Network, error) {
+	if config.BlockInterval == 0 {
+		config.BlockInterval = 100 * time.Millisecond
+	}
+	if config.KeepBlocks == 0 {
+		config.KeepBlocks = 100
+	}
+	keys := NodeKeys{
+		Authority: newKey(),
+		Gateway:   newKey(),
+		Relay:     newKey(),
+		Index:     newKey(),
+		Validator: newKey(),
+	}
+	token := keys.Authority.PublicKey()
+	network := &Network{Credentials: newKey(), Keys: keys}
+
+	authority, err := topos.NewSingleAuthority(ctx, topos.SingleAuthorityConfig{
+		Credentials:      keys.Authority,
+		BlockInterval:    config.BlockInterval,
+		ValidateIncoming: socket.AcceptAllConnections,
+		ValidateOutgoing: socket.AcceptAllConnections,
+		KeepBlocks:       config.KeepBlocks,
+	}, topos.NewWallets(0, config.Genesis))
+	if err != nil {
+		return nil, fmt.Errorf("could not start authority: %v", err)
+	}
+	network.Authority = authority
+
+	network.Gateway, err = topos.NewGateway(ctx, topos.GatewayConfig{
+		NodeAddress: Address(authority.Addr),
+		NodeToken:   token,
+		Credentials: keys.Gateway,
+		Validate:    socket.AcceptAllConnections,
+		Dresser:     topos.NewBreezeVoidDresser(keys.Gateway, config.Fee),
+	})
+	if err != nil {
+		network.Close()
+		return nil, fmt.Errorf("could not start gateway: %v", err)
+	}
+
+	relayChain, err := topos.OpenFSBlockchain(filepath.Join(config.Dir, "relay.chain"), false)
+	if err != nil {
+		network.Close()
+		return nil, fmt.Errorf("could not open relay blockchain: %v", err)
+	}
+	if err := relayChain.UpdateState(topos.NewWallets(0, config.Genesis)); err != nil {
+		relayChain.Close()
+		network.Close()
+		return nil, fmt.Errorf("could not replay relay blockchain: %v", err)
+	}
+	network.Relay, err = topos.NewRelay(ctx, topos.RelayConfig{
+		SourceAddress: Address(authority.OutgoingAddr),
+		SourceToken:   token,
+		Credentials:   keys.Relay,
+		Validate:      socket.AcceptAllConnections,
+	}, relayChain)
+	if err != nil {
+		relayChain.Close()
+		network.Close()
+		return nil, fmt.Errorf("could not start relay: %v", err)
+	}
+
+	indexChain, err := topos.OpenFSBlockchain(filepath.Join(config.Dir, "index.chain"), false)
+	if err != nil {
+		network.Close()
+		return nil, fmt.Errorf("could not open index blockchain: %v", err)
+	}
+	store := index.OpenIndex([index.NStores]papirus.ByteStore{papirus.NewMemoryStore(1 << 20)})
+	network.Index, err = index.NewDB(ctx, index.DBConfig{
+		SourceAddress: Address(authority.OutgoingAddr),
+		SourceToken:   token,
+		Credentials:   keys.Index,
+		Validate:      socket.AcceptAllConnections,
+	}, store, indexChain)
+	if err != nil {
+		indexChain.Close()
+		network.Close()
+		return nil, fmt.Errorf("could not start index db: %v", err)
+	}
+
+	axe := social.NewSocialBlockChain[*attorney.Mutations, *attorney.MutatingState](attorney.NewGenesisState(""), 0)
+	network.Validator, err = social.LaunchNode[*attorney.Mutations, *attorney.MutatingState](ctx, social.ProtocolValidatorNodeConfig{
+		BlockProviderAddr:  Address(authority.OutgoingAddr),
+		BlockProviderToken: token,
+		NodeCredentials:    keys.Validator,
+		ValidateOutgoing:   socket.AcceptAllConnections,
+		KeepNBlocks:        config.KeepBlocks,
+		Indexer:            attorneys.NewIndex(),
+		Listener:           topos.SingleAuthorityListener,
+	}, axe)
+	if err != nil {
+		network.Close()
+		return nil, fmt.Errorf("could not start axe validator: %v", err)
+	}
+	return network, nil
+}
+
+// Close stops the gateway first, then the nodes following the authority and
+// the authority last. It returns the first error that ended a node.
+func (n *Network) Close() error {
+	var first error
+	for _, handle := range []*social.Handle{n.Gateway, n.Validator, n.Relay, n.Index} {
+		if handle != nil {
+			if err := handle.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	if n.Authority != nil {
+		if err := n.Authority.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Submit sends action to the gateway.
+func (n *Network) Submit(action []byte) error {
+	return topos.SubmitAction(Address(n.Gateway.Addr), n.Keys.Gateway.PublicKey(), n.Credentials, action)
+}
+
+// Balance asks the relay for the balance of wallet.
+func (n *Network) Balance(wallet crypto.Token) (*topos.Balance, error) {
+	return topos.RequestBalance(Address(n.Relay.Addr), n.Keys.Relay.PublicKey(), n.Credentials, wallet)
+}
+
+// Observe follows the relay and sends on the returned channel every action it
+// forwards, starting with those already on its chain. The channel is closed
+// when ctx is done or the relay connection ends.
+func (n *Network) Observe(ctx context.Context) (chan []byte, error) {
+	conn, err := socket.Dial(Address(n.Relay.Addr), n.Credentials, n.Keys.Relay.PublicKey())
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to relay: %v", err)
+	}
+	if err := conn.Send(topos.NewSyncRequest(0)); err != nil {
+		conn.Shutdown()
+		return nil, fmt.Errorf("could not send sync request: %v", err)
+	}
+	observed := make(chan []byte)
+	go func() {
+		<-ctx.Done()
+		conn.Shutdown()
+	}()
+	go func() {
+		defer close(observed)
+		for {
+			data, err := conn.Read()
+			if err != nil || len(data) == 0 {
+				return
+			}
+			if data[0] == topos.MsgAction && len(data) > 1 {
+				select {
+				case observed <- data[1:]:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return observed, nil
+}
+
+// WaitFor observes the relay until action is forwarded or the timeout ends.
+func (n *Network) WaitFor(action []byte, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	observed, err := n.Observe(ctx)
+	if err != nil {
+		return err
+	}
+	for data := range observed {
+		if string(data) == string(action) {
+			return nil
+		}
+	}
+	return errors.New("action not observed on relay")
+}
@@ -0,0 +1,133 @@
+package harness
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/actions"
+	"github.com/freehandle/breeze/socket"
+)
+
+func TestSubmitForwarded(t *testing.T) {
+	from, wallet := crypto.RandomAsymetricKey()
+	to, _ := crypto.RandomAsymetricKey()
+	network, err := Start(context.Background(), Config{
+		Dir:           t.TempDir(),
+		BlockInterval: 50 * time.Millisecond,
+		Genesis:       map[crypto.Token]uint64{from: 1000},
+	})
+	if err != nil {
+		t.Fatalf("could not start network: %v", err)
+	}
+	defer network.Close()
+
+	balance, err := network.Balance(from)
+	if err != nil {
+		t.Fatalf("could not get balance: %v", err)
+	}
+	if balance.Wallet != 1000 {
+		t.Fatalf("expected genesis balance of 1000, got %v", balance.Wallet)
+	}
+	transfer := actions.Transfer{
+		TimeStamp: balance.Epoch,
+		From:      from,
+		To:        []crypto.TokenValue{{Token: to, Value: 10}},
+		Fee:       1,
+	}
+	transfer.Sign(wallet)
+	action := transfer.Serialize()
+	if err := network.Submit(action); err != nil {
+		t.Fatalf("could not submit action: %v", err)
+	}
+	if err := network.WaitFor(action, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		balance, err := network.Balance(to)
+		if err != nil {
+			t.Fatalf("could not get balance: %v", err)
+		}
+		if balance.Wallet == 10 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected balance of 10 after transfer, got %v", balance.Wallet)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// once its block is closed the action is synced from the relay chain file
+	time.Sleep(200 * time.Millisecond)
+	if err := network.WaitFor(action, 5*time.Second); err != nil {
+		t.Fatalf("closed block: %v", err)
+	}
+
+	if err := network.Close(); err != nil {
+		t.Fatalf("network did not stop cleanly: %v", err)
+	}
+}
+
+func TestRestartReleasesGoroutines(t *testing.T) {
+	from, wallet := crypto.RandomAsymetricKey()
+	to, _ := crypto.RandomAsymetricKey()
+	baseline := runtime.NumGoroutine()
+	for n := 0; n < 5; n++ {
+		network, err := Start(context.Background(), Config{
+			Dir:           t.TempDir(),
+			BlockInterval: 20 * time.Millisecond,
+			Genesis:       map[crypto.Token]uint64{from: 1000},
+		})
+		if err != nil {
+			t.Fatalf("could not start network: %v", err)
+		}
+		// connections left waiting for their first request on close
+		idle := make([]*socket.SignedConnection, 0)
+		for _, node := range []struct {
+			addr  net.Addr
+			token crypto.Token
+		}{
+			{network.Authority.OutgoingAddr, network.Keys.Authority.PublicKey()},
+			{network.Relay.Addr, network.Keys.Relay.PublicKey()},
+			{network.Index.Addr, network.Keys.Index.PublicKey()},
+			{network.Gateway.Addr, network.Keys.Gateway.PublicKey()},
+		} {
+			conn, err := socket.Dial(Address(node.addr), network.Credentials, node.token)
+			if err != nil {
+				t.Fatalf("could not connect: %v", err)
+			}
+			idle = append(idle, conn)
+		}
+		transfer := actions.Transfer{
+			TimeStamp: 1,
+			From:      from,
+			To:        []crypto.TokenValue{{Token: to, Value: 1}},
+			Fee:       1,
+		}
+		transfer.Sign(wallet)
+		if err := network.Submit(transfer.Serialize()); err != nil {
+			t.Fatalf("could not submit action: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if err := network.Close(); err != nil {
+			t.Fatalf("network did not stop cleanly: %v", err)
+		}
+		for _, conn := range idle {
+			conn.Shutdown()
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			t.Fatalf("%v goroutines left after restarts, %v before\n%s", runtime.NumGoroutine(), baseline, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
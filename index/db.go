@@ -1,6 +1,7 @@
 package index
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
@@ -8,6 +9,7 @@ import (
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/socket"
 	"github.com/freehandle/breeze/util"
+	"github.com/freehandle/cb/social"
 	"github.com/freehandle/cb/topos"
 )
 
@@ -15,7 +17,7 @@ import (
 type DBConfig struct {
 	SourceAddress string                    // url:port
 	SourceToken   crypto.Token              // known token of the block provider
-	Credentials   crypto.PrivateKey         // secret key of the relay node
+	Credentials   social.Signer             // key of the index node
 	ListenPort    int                       // other nodes must connect to this port
 	Validate      socket.ValidateConnection // check if a token is allowed
 	HashFunc      func([]byte) []crypto.Hash
@@ -33,37 +35,45 @@ type ActionWithHashes struct {
 	Hashes   []crypto.Hash
 }
 
-func NewDB(config DBConfig, index *Index, chain *topos.Blockchain) chan error {
-
-	finalize := make(chan error, 2)
+func NewDB(ctx context.Context, config DBConfig, index *Index, chain *topos.Blockchain) (*social.Handle, error) {
+	key, err := social.ConnectionKey(config.Credentials)
+	if err != nil {
+		return nil, err
+	}
 
 	listeners, err := net.Listen("tcp", fmt.Sprintf(":%v", config.ListenPort))
 	if err != nil {
-		finalize <- fmt.Errorf("could not listen on port %v: %v", config.ListenPort, err)
-		return finalize
+		return nil, fmt.Errorf("could not listen on port %v: %v", config.ListenPort, err)
 	}
 
-	conn, err := socket.Dial(config.SourceAddress, config.Credentials, config.SourceToken)
+	conn, err := socket.Dial(config.SourceAddress, key, config.SourceToken)
 	if err != nil {
-		finalize <- fmt.Errorf("could not connect to block provider: %v", err)
-		return finalize
+		listeners.Close()
+		return nil, fmt.Errorf("could not connect to block provider: %v", err)
 	}
 
 	if err := conn.Send(topos.NewSyncRequest(index.lastEpoch)); err != nil {
-		finalize <- fmt.Errorf("could not send sync request: %v", err)
-		return finalize
+		listeners.Close()
+		conn.Shutdown()
+		return nil, fmt.Errorf("could not send sync request: %v", err)
 	}
 
+	handle := social.NewHandle(ctx)
+	handle.Addr = listeners.Addr()
+
 	incorporate := make(chan *topos.RelaySyncRequest)
 	msg := make(chan []byte)
 
 	pool := make(socket.ConnectionPool)
+	readerDone := make(chan struct{})
+	quit := make(chan struct{})
 
 	go func() {
+		defer close(readerDone)
 		for {
 			data, err := conn.Read()
 			if err != nil {
-				finalize <- fmt.Errorf("error reading from block provider: %v", err)
+				handle.Fail(fmt.Errorf("error reading from block provider: %v", err))
 				return
 			}
 			if data[0] == topos.MsgBlock {
@@ -99,25 +109,44 @@ func NewDB(config DBConfig, index *Index, chain *topos.Blockchain) chan error {
 				pool[request.Token] = request.Conn
 				go chain.Sync(request.Conn, request.Epoch)
 			case data := <-msg:
-				pool.Broadcast(append([]byte{topos.MsgBlock}, data...))
+				pool.Broadcast(data)
+			case <-quit:
+				for _, conn := range pool {
+					conn.Close()
+				}
+				return
 			}
 		}
 	}()
 
+	// on stop: disconnect from the block provider, close connections and
+	// flush the chain file.
+	go func() {
+		<-handle.Stopping()
+		listeners.Close()
+		conn.Shutdown()
+		<-readerDone
+		quit <- struct{}{}
+		if err := chain.Close(); err != nil {
+			log.Printf("could not close blockchain: %v", err)
+		}
+		handle.Stopped()
+	}()
+
 	go func() {
 		for {
 			if conn, err := listeners.Accept(); err == nil {
-				trustedConn, err := socket.PromoteConnection(conn, config.Credentials, config.Validate)
+				trustedConn, err := socket.PromoteConnection(conn, key, config.Validate)
 				if err != nil {
 					conn.Close()
 				} else {
 
-					go topos.WaitSyncRequest(trustedConn, incorporate)
+					go topos.WaitRelayRequest(trustedConn, chain, incorporate, handle.Stopping())
 				}
 			} else {
 				return
 			}
 		}
 	}()
-	return finalize
+	return handle, nil
 }
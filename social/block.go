@@ -1,6 +1,8 @@
 package social
 
 import (
+	"errors"
+
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/util"
 )
@@ -51,14 +53,22 @@ func (p *ProtocolBuilder) Seal() crypto.Hash {
 	return hash
 }
 
-func (p *ProtocolBuilder) Finalize(invalidate []crypto.Hash, publisher crypto.PrivateKey) {
+// Finalize signs the sealed block with publisher. The block is left sealed if
+// the publisher signature is not valid.
+func (p *ProtocolBuilder) Finalize(invalidate []crypto.Hash, publisher Signer) error {
+	sealed := len(p.data)
 	util.PutHashArray(invalidate, &p.data)
 	hash := crypto.Hasher(p.data)
+	signature := publisher.Sign(hash[:])
+	if !publisher.PublicKey().Verify(hash[:], signature) {
+		p.data = p.data[:sealed]
+		return errors.New("invalid publisher signature")
+	}
 	util.PutHash(hash, &p.data)
 	util.PutToken(publisher.PublicKey(), &p.data)
-	signature := publisher.Sign(hash[:])
 	util.PutSignature(signature, &p.data)
 	p.status = 2
+	return nil
 }
 
 func (p *ProtocolBuilder) Bytes() []byte {
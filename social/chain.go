@@ -168,6 +168,27 @@ func (s *SocialBlockChain[M, B]) Commit(epoch uint64, invalidated []crypto.Hash)
 	return nil, fmt.Errorf("block %d not found", epoch)
 }
 
+// CommittedActions returns the actions of the committed block of epoch that
+// were not invalidated on its commit.
+func (s *SocialBlockChain[M, B]) CommittedActions(epoch uint64) [][]byte {
+	block := s.findBlock(epoch)
+	if block == nil || block.Status != StatusCommit {
+		return nil
+	}
+	invalidated := make(map[crypto.Hash]struct{})
+	for _, hash := range block.Invalidated {
+		invalidated[hash] = struct{}{}
+	}
+	actions := make([][]byte, 0, block.Actions.Len())
+	for n := 0; n < block.Actions.Len(); n++ {
+		action := block.Actions.Get(n)
+		if _, ok := invalidated[crypto.Hasher(action)]; !ok {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
 func (s *SocialBlockChain[M, B]) Rollback(epoch uint64) error {
 	if epoch < s.commitEpoch {
 		return fmt.Errorf("Rollback request to a commit epoch: rollback to %v vs commit %v", epoch, s.commitEpoch)
@@ -0,0 +1,71 @@
+package social
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// Handle is the lifecycle handle of a running node. The node stops when its
+// context is cancelled or when Close is called, and Wait returns once it has
+// released its resources. Addr is the bound listen address of the node, nil
+// for nodes that do not listen.
+type Handle struct {
+	Addr     net.Addr
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	err      error
+	failOnce sync.Once
+	doneOnce sync.Once
+}
+
+// NewHandle creates the handle of a node started with ctx.
+func NewHandle(ctx context.Context) *Handle {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Handle{ctx: ctx, cancel: cancel, done: make(chan struct{})}
+}
+
+// Close stops the node and waits for it to end.
+func (h *Handle) Close() error {
+	h.cancel()
+	return h.Wait()
+}
+
+// Wait blocks until the node has stopped and returns the error that ended it,
+// nil if it was closed.
+func (h *Handle) Wait() error {
+	<-h.done
+	return h.err
+}
+
+// Stopping is closed when the node is asked to shut down, either by its
+// context or by a failure.
+func (h *Handle) Stopping() <-chan struct{} {
+	return h.ctx.Done()
+}
+
+// IsStopping tells if the node was asked to shut down.
+func (h *Handle) IsStopping() bool {
+	return h.ctx.Err() != nil
+}
+
+// Fail records the error ending the node and asks it to shut down. Only the
+// first error is kept, and none once the node is stopping.
+func (h *Handle) Fail(err error) {
+	if h.IsStopping() {
+		return
+	}
+	h.failOnce.Do(func() {
+		h.err = err
+		h.cancel()
+	})
+}
+
+// Stopped is called by the node once it has released its resources.
+func (h *Handle) Stopped() {
+	h.doneOnce.Do(func() {
+		h.cancel()
+		close(h.done)
+	})
+}
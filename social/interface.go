@@ -20,3 +20,11 @@ type Stateful[T Merger[T], B Blocker[T]] interface {
 	ChecksumPoint() crypto.Hash
 	Recover() error
 }
+
+// Indexer indexes the actions of the blocks committed by a protocol validator
+// node, leaving out invalidated actions, and answers queries about them from
+// the node connections.
+type Indexer interface {
+	Index(action []byte)
+	Query(request []byte) []byte
+}
@@ -1,6 +1,7 @@
 package social
 
 import (
+	"context"
 	"log"
 
 	"github.com/freehandle/breeze/consensus/chain"
@@ -119,14 +120,24 @@ func SocialProtocolBlockListener(address string, node crypto.Token, credentials
 }
 
 // Connects to a node providing breeze new blocks and forward signals to the channel
-func BreezeBlockListener(config ProtocolValidatorNodeConfig, epoch uint64) chan *BlockSignal {
-	send := make(chan *BlockSignal)
-	conn, err := socket.Dial(config.BlockProviderAddr, config.NodeCredentials, config.BlockProviderToken)
+// The connection is closed, and an ErrSignal sent, when ctx is done.
+func BreezeBlockListener(ctx context.Context, config ProtocolValidatorNodeConfig, epoch uint64) chan *BlockSignal {
+	send := make(chan *BlockSignal, 1)
+	key, err := ConnectionKey(config.NodeCredentials)
+	if err != nil {
+		send <- &BlockSignal{Signal: ErrSignal, Err: err}
+		return send
+	}
+	conn, err := socket.Dial(config.BlockProviderAddr, key, config.BlockProviderToken)
 	if err != nil {
 		signal := &BlockSignal{Signal: ErrSignal, Err: err}
 		send <- signal
 		return send
 	}
+	go func() {
+		<-ctx.Done()
+		conn.Shutdown()
+	}()
 	go func() {
 		conn.Send(chain.SyncMessage(epoch))
 		for {
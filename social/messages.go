@@ -8,6 +8,21 @@ import (
 	"github.com/freehandle/breeze/util"
 )
 
+// Query messages are answered by validator nodes with an Indexer. Their
+// values do not collide with breeze chain messages.
+const (
+	MsgQuery byte = 128 + iota
+	MsgQueryResponse
+)
+
+func NewQuery(request []byte) []byte {
+	return append([]byte{MsgQuery}, request...)
+}
+
+func NewQueryResponse(response []byte) []byte {
+	return append([]byte{MsgQueryResponse}, response...)
+}
+
 func NewBlockSocial(epoch uint64) []byte {
 	bytes := []byte{chain.MsgNewBlock}
 	util.PutUint64(epoch, &bytes)
@@ -1,6 +1,8 @@
 package social
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -15,31 +17,49 @@ type ProtocolValidatorNodeConfig struct {
 	BlockProviderAddr  string
 	BlockProviderToken crypto.Token
 	Port               int
-	NodeCredentials    crypto.PrivateKey
+	NodeCredentials    Signer
 	ValidateOutgoing   socket.ValidateConnection
 	KeepNBlocks        int
+	Indexer            Indexer       // indexes committed actions and answers queries, optional
+	Listener           BlockListener // follows the block provider, BreezeBlockListener if nil
 }
 
-func LaunchNode[M Merger[M], B Blocker[M]](config ProtocolValidatorNodeConfig, blockchain *SocialBlockChain[M, B]) chan error {
-	finalize := make(chan error, 2)
+// BlockListener connects to the block provider of config and sends on the
+// returned channel the signals of every block after epoch. The connection is
+// closed, and an ErrSignal sent, when ctx is done.
+type BlockListener func(ctx context.Context, config ProtocolValidatorNodeConfig, epoch uint64) chan *BlockSignal
 
+func LaunchNode[M Merger[M], B Blocker[M]](ctx context.Context, config ProtocolValidatorNodeConfig, blockchain *SocialBlockChain[M, B]) (*Handle, error) {
+	key, err := ConnectionKey(config.NodeCredentials)
+	if err != nil {
+		return nil, err
+	}
 	outgoing, err := net.Listen("tcp", fmt.Sprintf(":%v", config.Port))
 	if err != nil {
-		finalize <- fmt.Errorf("could not listen on port %v: %v", config.Port, err)
-		return finalize
+		return nil, fmt.Errorf("could not listen on port %v: %v", config.Port, err)
 	}
+	handle := NewHandle(ctx)
+	handle.Addr = outgoing.Addr()
 
 	blockSyncRequest := make(chan BlockSyncRequest)
 	forward := make(chan []byte)
 	newBlock := make(chan struct{})
+	quit := make(chan struct{})
 
 	go func() {
-		messages := BreezeBlockListener(config, blockchain.epoch)
+		listener := config.Listener
+		if listener == nil {
+			listener = BreezeBlockListener
+		}
+		messages := listener(handle.ctx, config, blockchain.epoch)
 		for {
 			signal := <-messages
 			switch signal.Signal {
 			case ErrSignal:
-				finalize <- signal.Err
+				handle.Fail(signal.Err)
+				outgoing.Close()
+				quit <- struct{}{}
+				handle.Stopped()
 				return
 			case NewBlockSignal:
 				newBlock <- struct{}{}
@@ -56,8 +76,9 @@ func LaunchNode[M Merger[M], B Blocker[M]](config ProtocolValidatorNodeConfig, b
 				}
 			case ActionArraySignal:
 				for n := 0; n < signal.Actions.Len(); n++ {
-					if blockchain.Validate(signal.Action) {
-						forward <- ActionSocial(signal.Action)
+					action := signal.Actions.Get(n)
+					if blockchain.Validate(action) {
+						forward <- ActionSocial(action)
 					}
 				}
 			case SealSignal:
@@ -71,6 +92,11 @@ func LaunchNode[M Merger[M], B Blocker[M]](config ProtocolValidatorNodeConfig, b
 			case CommitSignal:
 				blockchain.Lock()
 				if invalidated, err := blockchain.Commit(signal.Epoch, signal.HashArray); err == nil {
+					if config.Indexer != nil {
+						for _, action := range blockchain.CommittedActions(signal.Epoch) {
+							config.Indexer.Index(action)
+						}
+					}
 					forward <- CommitBlockSocial(signal.Epoch, invalidated)
 				} else {
 					log.Printf("LaunchNode> %v", err)
@@ -84,13 +110,15 @@ func LaunchNode[M Merger[M], B Blocker[M]](config ProtocolValidatorNodeConfig, b
 	go func() {
 		for {
 			if conn, err := outgoing.Accept(); err == nil {
-				trustedConn, err := socket.PromoteConnection(conn, config.NodeCredentials, config.ValidateOutgoing)
+				trustedConn, err := socket.PromoteConnection(conn, key, config.ValidateOutgoing)
 				if err != nil {
 					conn.Close()
+				} else {
+					go WaitForOutgoingRequest(trustedConn, config.Indexer, blockSyncRequest)
 				}
-				go WaitForOutgoingSyncRequest(trustedConn, blockSyncRequest)
+			} else {
+				return
 			}
-
 		}
 	}()
 
@@ -110,12 +138,17 @@ func LaunchNode[M Merger[M], B Blocker[M]](config ProtocolValidatorNodeConfig, b
 				blockchain.Lock()
 				blockchain.Sync(cached, req.epoch)
 				blockchain.Unlock()
+			case <-quit:
+				for _, conn := range pool {
+					conn.Close()
+				}
+				return
 			}
 		}
 
 	}()
 
-	return finalize
+	return handle, nil
 
 }
 
@@ -124,12 +157,52 @@ type BlockSyncRequest struct {
 	epoch uint64
 }
 
-func WaitForOutgoingSyncRequest(conn *socket.SignedConnection, syncRequest chan BlockSyncRequest) {
+// WaitForOutgoingRequest answers queries on conn with indexer until it asks
+// to sync with the chain.
+func WaitForOutgoingRequest(conn *socket.SignedConnection, indexer Indexer, syncRequest chan BlockSyncRequest) {
+	for {
+		data, err := conn.Read()
+		if err != nil || len(data) == 0 {
+			conn.Shutdown()
+			return
+		}
+		if data[0] != MsgQuery {
+			if len(data) != 9 || data[0] != chain.MsgSyncRequest {
+				conn.Shutdown()
+				return
+			}
+			epoch, _ := util.ParseUint64(data, 1)
+			syncRequest <- BlockSyncRequest{conn: conn, epoch: epoch}
+			return
+		}
+		var response []byte
+		if indexer != nil {
+			response = indexer.Query(data[1:])
+		}
+		if err := conn.Send(NewQueryResponse(response)); err != nil {
+			conn.Shutdown()
+			return
+		}
+	}
+}
+
+// Query sends request to the validator node at address and returns its
+// response. An empty response means the node could not answer.
+func Query(address string, node crypto.Token, credentials crypto.PrivateKey, request []byte) ([]byte, error) {
+	conn, err := socket.Dial(address, credentials, node)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to node: %v", err)
+	}
+	defer conn.Shutdown()
+	if err := conn.Send(NewQuery(request)); err != nil {
+		return nil, fmt.Errorf("could not send query: %v", err)
+	}
 	data, err := conn.Read()
-	if err != nil || len(data) != 9 || data[0] != chain.MsgSyncRequest {
-		conn.Shutdown()
-		return
+	if err != nil {
+		return nil, fmt.Errorf("could not read query response: %v", err)
+	}
+	if len(data) == 0 || data[0] != MsgQueryResponse {
+		return nil, errors.New("invalid query response")
 	}
-	epoch, _ := util.ParseUint64(data, 1)
-	syncRequest <- BlockSyncRequest{conn: conn, epoch: epoch}
+	return data[1:], nil
 }
@@ -0,0 +1,29 @@
+package social
+
+import (
+	"fmt"
+
+	"github.com/freehandle/breeze/crypto"
+)
+
+// Signer signs on behalf of a token. A crypto.PrivateKey is a Signer, and so
+// are vault entry keys and keys held by a remote signing agent. Node configs
+// take the node key as a Signer.
+type Signer interface {
+	PublicKey() crypto.Token
+	Sign(data []byte) crypto.Signature
+}
+
+// ConnectionKey returns the private key of signer for the handshake of breeze
+// socket connections, which is signed with a crypto.PrivateKey. Signers that
+// do not hold their key, like agent keys, can sign blocks and actions but
+// can not authenticate the connections of a node.
+func ConnectionKey(signer Signer) (crypto.PrivateKey, error) {
+	if key, ok := signer.(crypto.PrivateKey); ok {
+		return key, nil
+	}
+	if signer == nil {
+		return crypto.PrivateKey{}, fmt.Errorf("no node key")
+	}
+	return crypto.PrivateKey{}, fmt.Errorf("key %v can not authenticate connections, it is not held by the node", signer.PublicKey())
+}
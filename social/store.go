@@ -101,3 +101,10 @@ func (b *BlockStore) GetBlock(n int) []byte {
 	store := b.stores[index.StoreNum]
 	return store.ReadAt(index.Offset, index.Size)
 }
+
+// Close flushes and closes the underlying byte stores.
+func (b *BlockStore) Close() {
+	for _, store := range b.stores {
+		store.Close()
+	}
+}
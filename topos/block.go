@@ -25,7 +25,7 @@ func (b *MemoryBlock) Get(n int) []byte {
 		starts = b.actions[n-1]
 	}
 	ends := b.actions[n]
-	return b.data[starts+1 : ends]
+	return b.data[starts:ends]
 }
 
 func (b *MemoryBlock) Append(data []byte) {
@@ -1,6 +1,7 @@
 package topos
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -18,24 +19,41 @@ const buffersize = 1 >> 24 // 16MB
 type BlockProviderConfig struct {
 	NodeAddress string
 	NodeToken   crypto.Token
-	Credentials crypto.PrivateKey
+	Credentials social.Signer
+	Publisher   social.Signer // signs published blocks, Credentials if nil
 	ListenPort  int
 	Validate    socket.ValidateConnection
 	Store       *social.BlockStore
 }
 
-func BlockProviderNode(config BlockProviderConfig) chan error {
-	finalize := make(chan error, 2)
-
+// BlockProviderNode builds social protocol blocks from the breeze blocks of
+// its source node and serves them from its store. The store is closed when
+// the node stops.
+func BlockProviderNode(ctx context.Context, config BlockProviderConfig) (*social.Handle, error) {
+	key, err := social.ConnectionKey(config.Credentials)
+	if err != nil {
+		return nil, err
+	}
 	listeners, err := net.Listen("tcp", fmt.Sprintf(":%v", config.ListenPort))
 	if err != nil {
-		finalize <- fmt.Errorf("could not listen on port %v: %v", config.ListenPort, err)
-		return finalize
+		return nil, fmt.Errorf("could not listen on port %v: %v", config.ListenPort, err)
 	}
 
-	source, err := socket.Dial(config.NodeAddress, config.Credentials, config.NodeToken)
+	source, err := socket.Dial(config.NodeAddress, key, config.NodeToken)
 	if err != nil {
-		finalize <- fmt.Errorf("could not connect to block provider node %v: %v", config.NodeAddress, err)
+		listeners.Close()
+		return nil, fmt.Errorf("could not connect to block provider node %v: %v", config.NodeAddress, err)
+	}
+	handle := social.NewHandle(ctx)
+	handle.Addr = listeners.Addr()
+	go func() {
+		<-handle.Stopping()
+		source.Shutdown()
+	}()
+
+	publisher := config.Credentials
+	if config.Publisher != nil {
+		publisher = config.Publisher
 	}
 
 	go func() {
@@ -44,7 +62,10 @@ func BlockProviderNode(config BlockProviderConfig) chan error {
 		for {
 			data, err := source.Read()
 			if err != nil {
+				handle.Fail(fmt.Errorf("error reading from block provider node: %v", err))
 				listeners.Close() // force finalize of listener connection
+				config.Store.Close()
+				handle.Stopped()
 				return
 			}
 			if len(data) == 0 {
@@ -77,8 +98,9 @@ func BlockProviderNode(config BlockProviderConfig) chan error {
 				epochCommit, position := util.ParseUint64(data, 1)
 				invalidated, _ := util.ParseHashArray(data, position)
 				if block, ok := notCommit[epochCommit]; ok && block.Sealed() {
-					block.Finalize(invalidated, config.Credentials)
-					if err := config.Store.AddBlock(block.Bytes()); err == nil {
+					if err := block.Finalize(invalidated, publisher); err != nil {
+						log.Printf("BlockProviderNode, could not sign block of epoch %v: %v", epochCommit, err)
+					} else if err := config.Store.AddBlock(block.Bytes()); err == nil {
 						delete(notCommit, epochCommit)
 					} else {
 						log.Printf("BlockProviderNode, could not add block to block store: %v", err)
@@ -94,10 +116,10 @@ func BlockProviderNode(config BlockProviderConfig) chan error {
 		for {
 			conn, err := listeners.Accept()
 			if err != nil {
-				finalize <- err
+				handle.Fail(err)
 				return
 			}
-			trustedConn, err := socket.PromoteConnection(conn, config.Credentials, config.Validate)
+			trustedConn, err := socket.PromoteConnection(conn, key, config.Validate)
 			if err != nil {
 				conn.Close()
 			} else {
@@ -106,7 +128,7 @@ func BlockProviderNode(config BlockProviderConfig) chan error {
 		}
 	}()
 
-	return finalize
+	return handle, nil
 }
 
 func NewBlockProvider(port int, pk crypto.PrivateKey, validate socket.ValidateConnection, store *social.BlockStore) chan error {
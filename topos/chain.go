@@ -22,11 +22,17 @@ type Blockchain struct {
 	strict  bool
 }
 
+// UpdateState brings state up to the chain epoch and makes it the state of
+// the chain. The chain is locked throughout, so that no block or action is
+// missed by state. The chain state is left as it was on failure.
 func (b *Blockchain) UpdateState(state ProtocolState) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	if err := replayChain(state, b, b.strict); err != nil {
+		return err
+	}
 	b.state = state
-	return UpdateStateWithChain(state, b, b.strict)
+	return nil
 }
 
 // sync a new connection
@@ -61,11 +67,34 @@ func (b *Blockchain) Sync(conn *socket.CachedConnection, epoch uint64) {
 	conn.Ready()
 }
 
+// Balance returns the balance of token at the current epoch if the chain
+// state is a Balancer.
+func (b *Blockchain) Balance(token crypto.Token) (*Balance, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	balancer, ok := b.state.(Balancer)
+	if !ok {
+		return nil, false
+	}
+	balance := Balance{Token: token, Epoch: b.current.epoch}
+	balance.Wallet, balance.Deposit = balancer.Balance(token)
+	return &balance, true
+}
+
+// Close flushes the blockchain file to disk and closes it.
 func (b *Blockchain) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.file.Sync(); err != nil {
+		b.file.Close()
+		return err
+	}
 	return b.file.Close()
 }
 
 func (b *Blockchain) NextBlock(epoch uint64, hash crypto.Hash) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	if (!hash.Equal(b.current.Hash())) && b.strict {
 		return errors.New("block hash mismatch in strict mode")
 	}
@@ -74,12 +103,16 @@ func (b *Blockchain) NextBlock(epoch uint64, hash crypto.Hash) error {
 			return fmt.Errorf("block update incompatible with state update: %v", err)
 		}
 	}
-	b.file.Seek(0, 2)
+	position, err := b.file.Seek(0, 2)
+	if err != nil {
+		return fmt.Errorf("could not seek blockchain file: %v", err)
+	}
 	data := []byte{MsgBlock}
 	util.PutUint64(b.current.epoch, &data)
 	if n, err := b.file.Write(data); n != len(data) {
 		return fmt.Errorf("could not write to blockchain file: %v", err)
 	}
+	b.blocks = append(b.blocks, position+int64(len(data)))
 	for n := 0; n < b.current.Len(); n++ {
 		bytes := b.current.Get(n)
 		data := []byte{MsgAction}
@@ -98,6 +131,8 @@ func (b *Blockchain) NextBlock(epoch uint64, hash crypto.Hash) error {
 }
 
 func (b *Blockchain) Retrieve(positions map[uint64][]int) [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	epochs := make(sort.IntSlice, 0, len(positions))
 	for epoch, _ := range positions {
 		epochs = append(epochs, int(epoch))
@@ -106,7 +141,7 @@ func (b *Blockchain) Retrieve(positions map[uint64][]int) [][]byte {
 	output := make([][]byte, 0)
 	for _, epoch := range epochs {
 		seq := positions[uint64(epoch)]
-		data := b.RetrieveEpoch(uint64(epoch), seq)
+		data := b.retrieveEpoch(uint64(epoch), seq)
 		if len(data) > 0 {
 			output = append(output, data...)
 		}
@@ -115,12 +150,18 @@ func (b *Blockchain) Retrieve(positions map[uint64][]int) [][]byte {
 }
 
 func (b *Blockchain) RetrieveEpoch(height uint64, sequences []int) [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.retrieveEpoch(height, sequences)
+}
+
+func (b *Blockchain) retrieveEpoch(height uint64, sequences []int) [][]byte {
 	var block *MemoryBlock
 	if height == b.current.epoch {
 		block = b.current
 	} else if height < b.current.epoch {
 		var err error
-		if block, err = b.Block(height); err != nil {
+		if block, err = b.block(height); err != nil {
 			return nil
 		}
 	}
@@ -129,15 +170,23 @@ func (b *Blockchain) RetrieveEpoch(height uint64, sequences []int) [][]byte {
 	}
 	output := make([][]byte, 0)
 	for _, seq := range sequences {
-		if seq >= b.current.Len() {
+		if seq >= block.Len() {
 			return nil
 		}
-		output = append(output, b.current.Get(seq))
+		output = append(output, block.Get(seq))
 	}
 	return output
 }
 
 func (b *Blockchain) Block(height uint64) (*MemoryBlock, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.block(height)
+}
+
+// block reads the block at height from the chain file. The chain must be
+// locked.
+func (b *Blockchain) block(height uint64) (*MemoryBlock, error) {
 	if int(height) >= len(b.blocks) {
 		return nil, errors.New("height out of range")
 	}
@@ -158,12 +207,13 @@ func (b *Blockchain) Block(height uint64) (*MemoryBlock, error) {
 		value, _ := util.ParseUint64(msg, 1)
 		if msg[0] == MsgBlock {
 			return &block, nil
-		} else if msg[1] == MsgAction {
+		} else if msg[0] == MsgAction {
 			pos = pos + 9
 			action := make([]byte, int(value))
 			if n, err := b.file.ReadAt(action, pos); n != len(action) {
 				return nil, fmt.Errorf("could not parse blockchain file: %v", err)
 			}
+			pos = pos + int64(len(action))
 			block.Append(action) // nil = no broadcast
 		} else {
 			return nil, fmt.Errorf("invalid message type on file at position %v", pos)
@@ -185,12 +235,13 @@ func (b *Blockchain) Append(data []byte) error {
 	return err
 }
 
+// OpenFSBlockchain opens the blockchain file at path, creating it if it does
+// not exist.
 func OpenFSBlockchain(path string, strict bool) (*Blockchain, error) {
-	file, err := os.Open(path)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 	pos := int64(0)
 	msg := make([]byte, 9)
 	height := uint64(0)
@@ -203,13 +254,20 @@ func OpenFSBlockchain(path string, strict bool) (*Blockchain, error) {
 	for {
 		if n, err := file.ReadAt(msg, pos); n != 9 {
 			if err == io.EOF {
+				chain.current = &MemoryBlock{
+					epoch:   uint64(len(chain.blocks)),
+					data:    make([]byte, 0),
+					actions: make([]int, 0),
+				}
 				return &chain, nil
 			}
+			file.Close()
 			return nil, fmt.Errorf("could not parse blockchain file: %v", err)
 		}
 		value, _ := util.ParseUint64(msg, 1)
 		if msg[0] == MsgBlock {
 			if value > 0 && value != height+1 {
+				file.Close()
 				return nil, fmt.Errorf("block out of sequence on file at position %v", pos)
 			}
 			height = value
@@ -218,6 +276,7 @@ func OpenFSBlockchain(path string, strict bool) (*Blockchain, error) {
 		} else if msg[0] == MsgAction {
 			pos = pos + 9 + int64(value)
 		} else {
+			file.Close()
 			return nil, fmt.Errorf("invalid message type on file at position %v", pos)
 		}
 	}
@@ -230,24 +289,22 @@ type RecentBlocks struct {
 	maxBlocks int
 }
 
+// Sync sends to conn the blocks after epoch, the current one included, and
+// then the messages queued on conn meanwhile.
 func (r *RecentBlocks) Sync(conn *socket.CachedConnection, epoch uint64) {
 	r.mu.Lock()
-	shift := int(epoch) - int(r.blocks[0].epoch)
-	cache := make([]*MemoryBlock, 0)
-	if shift > 1 {
-		for n := shift; n < len(r.blocks); n++ {
-			cache = append(cache, r.blocks[n])
-		}
-		cache = append(cache, r.current.Clone())
-	}
+	cache := append(append(make([]*MemoryBlock, 0), r.blocks...), r.current.Clone())
 	r.mu.Unlock()
-	if shift < 1 {
+	if epoch < cache[0].epoch {
 		conn.Send(append([]byte{MsgSyncError}, []byte("node does not have information that old")...))
 		conn.Close()
 		conn.Live = false
 		return
 	}
 	for n := 1; n < len(cache); n++ {
+		if cache[n].epoch <= epoch {
+			continue
+		}
 		hash := cache[n-1].Hash()
 		epoch := cache[n].epoch
 		data := []byte{MsgBlock}
@@ -276,6 +333,8 @@ func NewRecentBlocks(maxBlocks int, epoch uint64) *RecentBlocks {
 }
 
 func (r *RecentBlocks) Append(action []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.current.Append(action)
 }
 
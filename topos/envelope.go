@@ -0,0 +1,79 @@
+package topos
+
+import (
+	"errors"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/actions"
+	"github.com/freehandle/breeze/util"
+)
+
+// Envelope kinds.
+const (
+	EnvelopeBreeze byte = iota // breeze action signed by its author
+	EnvelopeAxe                // axe action signed by its author and dressed for breeze
+)
+
+var envelopeMagic = []byte("cbe")
+
+const envelopeVersion byte = 1
+
+// Envelope carries an unsigned action from the machine that prepares it to
+// the one holding the key of its signer, and the signed action back to be
+// submitted to a gateway.
+type Envelope struct {
+	Kind   byte
+	Signer crypto.Token
+	Fee    uint64 // fee of the breeze action dressing axe actions
+	Action []byte // serialized action, the signature is its trailing bytes
+	Signed []byte // action ready to submit, empty until signed
+}
+
+func (e *Envelope) Serialize() []byte {
+	data := append([]byte{}, envelopeMagic...)
+	data = append(data, envelopeVersion, e.Kind)
+	util.PutToken(e.Signer, &data)
+	util.PutUint64(e.Fee, &data)
+	util.PutLargeByteArray(e.Action, &data)
+	util.PutLargeByteArray(e.Signed, &data)
+	return data
+}
+
+func ParseEnvelope(data []byte) (*Envelope, error) {
+	header := len(envelopeMagic) + 2
+	if len(data) < header || string(data[:len(envelopeMagic)]) != string(envelopeMagic) {
+		return nil, errors.New("not an action envelope")
+	}
+	if data[len(envelopeMagic)] != envelopeVersion {
+		return nil, errors.New("unsupported action envelope version")
+	}
+	envelope := Envelope{Kind: data[header-1]}
+	if envelope.Kind != EnvelopeBreeze && envelope.Kind != EnvelopeAxe {
+		return nil, errors.New("unknown action envelope kind")
+	}
+	position := header
+	envelope.Signer, position = util.ParseToken(data, position)
+	envelope.Fee, position = util.ParseUint64(data, position)
+	envelope.Action, position = util.ParseLargeByteArray(data, position)
+	envelope.Signed, position = util.ParseLargeByteArray(data, position)
+	if position != len(data) || len(envelope.Action) <= len(crypto.Signature{}) {
+		return nil, errors.New("invalid action envelope")
+	}
+	return &envelope, nil
+}
+
+// Sign signs the action with the key of the envelope signer. Axe actions are
+// then dressed as breeze actions paying the envelope fee.
+func (e *Envelope) Sign(key crypto.PrivateKey) error {
+	if key.PublicKey() != e.Signer {
+		return errors.New("key does not match envelope signer")
+	}
+	unsigned := len(e.Action) - len(crypto.Signature{})
+	signature := key.Sign(e.Action[:unsigned])
+	signed := append(append([]byte{}, e.Action[:unsigned]...), signature[:]...)
+	if e.Kind == EnvelopeAxe {
+		signed = actions.Dress(signed, key, e.Fee)
+	}
+	e.Signed = signed
+	return nil
+}
@@ -1,31 +1,37 @@
 package topos
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"net"
-	"sync"
 
 	"github.com/freehandle/breeze/consensus/chain"
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/protocol/actions"
 	"github.com/freehandle/breeze/socket"
+	"github.com/freehandle/cb/social"
 )
 
+// Dresser wraps actions before they are forwarded. Actions it can not dress
+// are dropped when it returns nil.
 type Dresser interface {
 	Dress([]byte) []byte
 }
 
-func NewBreezeVoidDresser(pk crypto.PrivateKey, fee uint64) *BreezeVoidDresseer {
+// NewBreezeVoidDresser dresses void actions with the wallet of signer, which
+// pays the fee.
+func NewBreezeVoidDresser(signer social.Signer, fee uint64) *BreezeVoidDresseer {
 	return &BreezeVoidDresseer{
-		secret: pk,
-		wallet: pk.PublicKey(),
+		signer: signer,
+		wallet: signer.PublicKey(),
 		fee:    fee,
 	}
 }
 
 type BreezeVoidDresseer struct {
-	secret crypto.PrivateKey
+	signer social.Signer
 	wallet crypto.Token
 	fee    uint64
 }
@@ -43,16 +49,58 @@ func (b *BreezeVoidDresseer) Dress(data []byte) []byte {
 		}
 		void.Wallet = b.wallet
 		void.Fee = b.fee
-		void.Sign(b.secret)
+		if !signVoid(void, b.signer) {
+			return nil
+		}
 		return void.Serialize()
 	}
 	return data
 }
 
+// signVoid signs void with signer and reports if the signature is valid.
+// Local keys sign with breeze Void.Sign. Other signers sign the bytes that
+// Void.Sign would, taken from the breeze serialization of void.
+func signVoid(void *actions.Void, signer social.Signer) bool {
+	if key, ok := signer.(crypto.PrivateKey); ok {
+		void.Sign(key)
+		return true
+	}
+	unsigned, ok := unsignedVoid(void)
+	if !ok {
+		return false
+	}
+	void.Signature = signer.Sign(unsigned)
+	return signer.PublicKey().Verify(unsigned, void.Signature)
+}
+
+// unsignedVoid returns the breeze serialization of void up to its signature,
+// the bytes its signature covers. The signature is located by serializing
+// void with two different signatures; it must be the last field.
+func unsignedVoid(void *actions.Void) ([]byte, bool) {
+	var marked crypto.Signature
+	for n := range marked {
+		marked[n] = 0xff
+	}
+	void.Signature = marked
+	other := void.Serialize()
+	void.Signature = crypto.Signature{}
+	data := void.Serialize()
+	start := len(data) - len(crypto.Signature{})
+	if len(other) != len(data) || start < 0 || !bytes.Equal(data[:start], other[:start]) {
+		return nil, false
+	}
+	for n := start; n < len(data); n++ {
+		if data[n] != 0 || other[n] != 0xff {
+			return nil, false
+		}
+	}
+	return data[:start], true
+}
+
 type GatewayConfig struct {
 	NodeAddress string
 	NodeToken   crypto.Token
-	Credentials crypto.PrivateKey
+	Credentials social.Signer
 	ListenPort  int
 	Validate    socket.ValidateConnection
 	Dresser     Dresser
@@ -63,40 +111,51 @@ type GatewayConnection struct {
 	Live bool
 }
 
-func NewGateway(config GatewayConfig) chan error {
-
-	finalize := make(chan error, 2)
+// NewGateway forwards actions received from its connections to the block
+// provider. When stopped it refuses new connections, closes the live ones and
+// forwards the actions they had already sent before it disconnects from the
+// block provider.
+func NewGateway(ctx context.Context, config GatewayConfig) (*social.Handle, error) {
+	key, err := social.ConnectionKey(config.Credentials)
+	if err != nil {
+		return nil, err
+	}
 
 	listeners, err := net.Listen("tcp", fmt.Sprintf(":%v", config.ListenPort))
 	if err != nil {
-		finalize <- fmt.Errorf("could not listen on port %v: %v", config.ListenPort, err)
-		return finalize
+		return nil, fmt.Errorf("could not listen on port %v: %v", config.ListenPort, err)
 	}
 
 	fmt.Printf("gateway trying to connect to block provider: %v\n", config.NodeAddress)
-	conn, err := socket.Dial(config.NodeAddress, config.Credentials, config.NodeToken)
+	conn, err := socket.Dial(config.NodeAddress, key, config.NodeToken)
 	if err != nil {
-		finalize <- fmt.Errorf("could not connect to block provider: %v", err)
-		return finalize
+		listeners.Close()
+		return nil, fmt.Errorf("could not connect to block provider: %v", err)
 	}
 	fmt.Println("gateway connected to block provider")
 	action := make(chan []byte)
 	connection := make(chan GatewayConnection)
 
-	live := make(map[crypto.Token]*socket.SignedConnection)
+	live := make(map[*socket.SignedConnection]struct{}) // by connection, a token may connect more than once
 	shutdown := false
-
-	lock := sync.Mutex{}
+	handle := social.NewHandle(ctx)
+	handle.Addr = listeners.Addr()
 
 	go func() {
 		for {
 			if conn, err := listeners.Accept(); err == nil {
-				trustedConn, err := socket.PromoteConnection(conn, config.Credentials, config.Validate)
+				trustedConn, err := socket.PromoteConnection(conn, key, config.Validate)
 				if err != nil {
 					conn.Close()
 				} else {
 					fmt.Println("gateway accepted connection")
-					go WaitForActions(trustedConn, connection, action)
+					select {
+					case connection <- GatewayConnection{Conn: trustedConn, Live: true}:
+						go WaitForActions(trustedConn, connection, action)
+					case <-handle.Stopping():
+						trustedConn.Shutdown()
+						return
+					}
 				}
 			} else {
 				return
@@ -105,33 +164,44 @@ func NewGateway(config GatewayConfig) chan error {
 	}()
 
 	go func() {
+		stopping := handle.Stopping()
 		for {
 			select {
 			case connection := <-connection:
-				lock.Lock()
 				if connection.Live {
-					live[connection.Conn.Token] = connection.Conn
+					if shutdown {
+						connection.Conn.Shutdown()
+					}
+					live[connection.Conn] = struct{}{}
 				} else {
-					delete(live, connection.Conn.Token)
+					delete(live, connection.Conn)
 				}
-				lock.Unlock()
 				if shutdown && len(live) == 0 {
 					fmt.Println("gateway shutting down")
-					finalize <- nil
+					conn.Shutdown()
+					handle.Stopped()
 					return
 				}
-			case data := <-action:
-				if len(data) == 0 {
-					lock.Lock()
-					shutdown = true
-					for _, conn := range live {
-						fmt.Println("connection shutting down")
-						conn.Shutdown()
-					}
-					lock.Unlock()
+			case <-stopping:
+				stopping = nil
+				listeners.Close()
+				shutdown = true
+				if len(live) == 0 {
+					fmt.Println("gateway shutting down")
+					conn.Shutdown()
+					handle.Stopped()
+					return
+				}
+				for conn := range live {
+					fmt.Println("connection shutting down")
+					conn.Shutdown()
 				}
+			case data := <-action:
 				if config.Dresser != nil {
-					data = config.Dresser.Dress(data)
+					if data = config.Dresser.Dress(data); data == nil {
+						log.Print("could not dress action, dropped")
+						continue
+					}
 				}
 				if err := conn.Send(append([]byte{chain.MsgActionSubmit}, data...)); err != nil {
 					log.Printf("could not send action to block provider: %v", err)
@@ -140,7 +210,7 @@ func NewGateway(config GatewayConfig) chan error {
 		}
 	}()
 
-	return finalize
+	return handle, nil
 }
 
 func WaitForActions(conn *socket.SignedConnection, terminate chan GatewayConnection, action chan []byte) {
@@ -155,3 +225,17 @@ func WaitForActions(conn *socket.SignedConnection, terminate chan GatewayConnect
 		action <- data[1:]
 	}
 }
+
+// SubmitAction sends action to the gateway at address, to be forwarded to its
+// block provider.
+func SubmitAction(address string, gateway crypto.Token, credentials crypto.PrivateKey, action []byte) error {
+	conn, err := socket.Dial(address, credentials, gateway)
+	if err != nil {
+		return fmt.Errorf("could not connect to gateway: %v", err)
+	}
+	defer conn.Shutdown()
+	if err := conn.Send(append([]byte{chain.MsgActionSubmit}, action...)); err != nil {
+		return fmt.Errorf("could not send action to gateway: %v", err)
+	}
+	return nil
+}
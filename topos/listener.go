@@ -0,0 +1,78 @@
+package topos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/freehandle/breeze/socket"
+	"github.com/freehandle/cb/social"
+)
+
+// SingleAuthorityListener is a social.BlockListener for protocol validators
+// following a single authority node on its outgoing port. Blocks of a single
+// authority are final: when a block starts, the previous one is sealed with
+// the hash sent by the authority and committed with no invalidated actions.
+func SingleAuthorityListener(ctx context.Context, config social.ProtocolValidatorNodeConfig, epoch uint64) chan *social.BlockSignal {
+	send := make(chan *social.BlockSignal, 1)
+	key, err := social.ConnectionKey(config.NodeCredentials)
+	if err != nil {
+		send <- &social.BlockSignal{Signal: social.ErrSignal, Err: err}
+		return send
+	}
+	conn, err := socket.Dial(config.BlockProviderAddr, key, config.BlockProviderToken)
+	if err != nil {
+		send <- &social.BlockSignal{Signal: social.ErrSignal, Err: err}
+		return send
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Shutdown()
+	}()
+	go func() {
+		fail := func(err error) {
+			send <- &social.BlockSignal{Signal: social.ErrSignal, Err: err}
+		}
+		if err := conn.Send(NewSyncRequest(epoch)); err != nil {
+			fail(fmt.Errorf("could not send sync request: %v", err))
+			return
+		}
+		var live uint64
+		started := false
+		for {
+			data, err := conn.Read()
+			if err != nil {
+				fail(err)
+				return
+			}
+			if len(data) == 0 {
+				continue
+			}
+			switch data[0] {
+			case MsgBlock:
+				next, hash, err := ParseBlock(data)
+				if err != nil {
+					fail(err)
+					return
+				}
+				send <- &social.BlockSignal{Signal: social.NewBlockSignal, Epoch: next}
+				if started {
+					send <- &social.BlockSignal{Signal: social.SealSignal, Epoch: live, Hash: hash}
+					send <- &social.BlockSignal{Signal: social.CommitSignal, Epoch: live}
+				}
+				live, started = next, true
+			case MsgAction:
+				if len(data) > 1 {
+					send <- &social.BlockSignal{Signal: social.ActionSignal, Action: data[1:]}
+				}
+			case MsgSyncError:
+				fail(fmt.Errorf("block provider refused sync: %s", data[1:]))
+				return
+			default:
+				fail(errors.New("invalid message from block provider"))
+				return
+			}
+		}
+	}()
+	return send
+}
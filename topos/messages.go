@@ -1,8 +1,10 @@
 package topos
 
 import (
+	"errors"
 	"fmt"
 
+	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/util"
 )
 
@@ -12,6 +14,8 @@ const (
 	MsgSyncRequest
 	MsgActionSubmit
 	MsgSyncError
+	MsgBalanceRequest
+	MsgBalance
 )
 
 type ProtocolState interface {
@@ -23,6 +27,13 @@ type ProtocolState interface {
 func UpdateStateWithChain(state ProtocolState, chain *Blockchain, strict bool) error {
 	chain.mu.Lock()
 	defer chain.mu.Unlock()
+	return replayChain(state, chain, strict)
+}
+
+// replayChain brings state up to the chain epoch, replaying the actions and
+// block boundaries of every block since the state epoch. The chain must be
+// locked.
+func replayChain(state ProtocolState, chain *Blockchain, strict bool) error {
 	start := state.Epoch()
 	end := chain.current.epoch
 	if start > end {
@@ -36,7 +47,7 @@ func UpdateStateWithChain(state ProtocolState, chain *Blockchain, strict bool) e
 		if n == end {
 			block = chain.current
 		} else {
-			if b, err := chain.Block(n); err != nil {
+			if b, err := chain.block(n); err != nil {
 				return fmt.Errorf("could not read block %v: %v", n, err)
 			} else {
 				block = b
@@ -47,6 +58,11 @@ func UpdateStateWithChain(state ProtocolState, chain *Blockchain, strict bool) e
 				return fmt.Errorf("invalid action in strict mode: action %v in block %v: %v", l, n, err)
 			}
 		}
+		if n < end {
+			if err := state.NextBlock(n + 1); err != nil {
+				return fmt.Errorf("could not replay block %v: %v", n+1, err)
+			}
+		}
 	}
 	return nil
 }
@@ -56,3 +72,58 @@ func NewSyncRequest(epoch uint64) []byte {
 	util.PutUint64(epoch, &data)
 	return data
 }
+
+// ParseBlock parses a new block message into its epoch and the hash of the
+// previous block.
+func ParseBlock(data []byte) (uint64, crypto.Hash, error) {
+	if len(data) != 1+8+crypto.Size || data[0] != MsgBlock {
+		return 0, crypto.Hash{}, errors.New("ParseBlock: invalid message")
+	}
+	epoch, position := util.ParseUint64(data, 1)
+	hash, _ := util.ParseHash(data, position)
+	return epoch, hash, nil
+}
+
+func NewBalanceRequest(token crypto.Token) []byte {
+	data := []byte{MsgBalanceRequest}
+	util.PutToken(token, &data)
+	return data
+}
+
+func ParseBalanceRequest(data []byte) (crypto.Token, error) {
+	if len(data) != 1+crypto.Size || data[0] != MsgBalanceRequest {
+		return crypto.Token{}, errors.New("ParseBalanceRequest: invalid message")
+	}
+	token, _ := util.ParseToken(data, 1)
+	return token, nil
+}
+
+// Balance is the balance of a wallet at the epoch of the node asked for it.
+type Balance struct {
+	Token   crypto.Token
+	Epoch   uint64
+	Wallet  uint64
+	Deposit uint64
+}
+
+func (b *Balance) Serialize() []byte {
+	data := []byte{MsgBalance}
+	util.PutToken(b.Token, &data)
+	util.PutUint64(b.Epoch, &data)
+	util.PutUint64(b.Wallet, &data)
+	util.PutUint64(b.Deposit, &data)
+	return data
+}
+
+func ParseBalance(data []byte) *Balance {
+	if len(data) != 1+crypto.Size+24 || data[0] != MsgBalance {
+		return nil
+	}
+	var balance Balance
+	position := 1
+	balance.Token, position = util.ParseToken(data, position)
+	balance.Epoch, position = util.ParseUint64(data, position)
+	balance.Wallet, position = util.ParseUint64(data, position)
+	balance.Deposit, _ = util.ParseUint64(data, position)
+	return &balance
+}
@@ -1,46 +1,64 @@
 package topos
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"time"
 
+	"github.com/freehandle/breeze/consensus/chain"
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/socket"
 	"github.com/freehandle/breeze/util"
+	"github.com/freehandle/cb/social"
 )
 
 type SingleAuthorityConfig struct {
 	IncomingPort     int
 	OutgoingPort     int
-	Credentials      crypto.PrivateKey
+	Credentials      social.Signer
 	BlockInterval    time.Duration
 	ValidateIncoming socket.ValidateConnection
 	ValidateOutgoing socket.ValidateConnection
 	KeepBlocks       int
 }
 
+// SingleAuthority is the handle of a proof of authority node.
+type SingleAuthority struct {
+	*social.Handle
+	OutgoingAddr net.Addr
+}
+
 type OutgoindConnectionRequest struct {
 	conn  *socket.SignedConnection
 	epoch uint64
 }
 
-func NewSingleAuthority(config SingleAuthorityConfig, state ProtocolState) chan error {
-
-	finalize := make(chan error, 2)
+// NewSingleAuthority runs a proof of authority node forming a block every
+// BlockInterval. The handle address is the incoming port; the outgoing port
+// is returned by OutgoingAddr.
+func NewSingleAuthority(ctx context.Context, config SingleAuthorityConfig, state ProtocolState) (*SingleAuthority, error) {
+	key, err := social.ConnectionKey(config.Credentials)
+	if err != nil {
+		return nil, err
+	}
 
 	incomming, err := net.Listen("tcp", fmt.Sprintf(":%v", config.IncomingPort))
 	if err != nil {
-		finalize <- fmt.Errorf("could not listen on port %v: %v", config.IncomingPort, err)
-		return finalize
+		return nil, fmt.Errorf("could not listen on port %v: %v", config.IncomingPort, err)
 	}
 
 	outgoing, err := net.Listen("tcp", fmt.Sprintf(":%v", config.OutgoingPort))
 	if err != nil {
-		finalize <- fmt.Errorf("could not listen on port %v: %v", config.OutgoingPort, err)
-		return finalize
+		incomming.Close()
+		return nil, fmt.Errorf("could not listen on port %v: %v", config.OutgoingPort, err)
 	}
 
+	authority := &SingleAuthority{Handle: social.NewHandle(ctx), OutgoingAddr: outgoing.Addr()}
+	authority.Addr = incomming.Addr()
+	quit := make(chan struct{})
+	formationDone := make(chan struct{})
+
 	endIncomming := make(chan crypto.Token)
 	newIncoming := make(chan *socket.SignedConnection)
 	incomingConnections := make(map[crypto.Token]*socket.SignedConnection)
@@ -59,27 +77,43 @@ func NewSingleAuthority(config SingleAuthorityConfig, state ProtocolState) chan
 	// listen incomming
 	go func() {
 		for {
-			if conn, err := incomming.Accept(); err == nil {
-				trustedConn, err := socket.PromoteConnection(conn, config.Credentials, config.ValidateIncoming)
-				if err != nil {
-					conn.Close()
-				}
-				newIncoming <- trustedConn
+			conn, err := incomming.Accept()
+			if err != nil {
+				authority.Fail(err)
+				return
+			}
+			trustedConn, err := socket.PromoteConnection(conn, key, config.ValidateIncoming)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			select {
+			case newIncoming <- trustedConn:
+			case <-authority.Stopping():
+				trustedConn.Shutdown()
+				return
 			}
 		}
 	}()
 
 	// manage incoming connections and block formation
 	go func() {
+		defer close(formationDone)
 		for {
 			select {
+			case <-authority.Stopping():
+				ticker.Stop()
+				for _, conn := range incomingConnections {
+					conn.Shutdown()
+				}
+				return
 			case token := <-endIncomming:
 				delete(incomingConnections, token)
 			case conn := <-newIncoming:
 				incomingConnections[conn.Token] = conn
-				go WaitForProtocolActions(conn, endIncomming, action)
+				go WaitForProtocolActions(conn, endIncomming, action, authority.Stopping())
 			case proposed := <-action:
-				if err := state.Action(proposed); err != nil {
+				if err := state.Action(proposed); err == nil {
 					incorporated <- proposed
 				}
 			case <-ticker.C:
@@ -91,6 +125,17 @@ func NewSingleAuthority(config SingleAuthorityConfig, state ProtocolState) chan
 		}
 	}()
 
+	// on stop: refuse new connections and close existing ones once no more
+	// blocks are formed.
+	go func() {
+		<-authority.Stopping()
+		incomming.Close()
+		outgoing.Close()
+		<-formationDone
+		quit <- struct{}{}
+		authority.Stopped()
+	}()
+
 	go func() {
 		for {
 			select {
@@ -103,6 +148,7 @@ func NewSingleAuthority(config SingleAuthorityConfig, state ProtocolState) chan
 				pool.DropDead() // clear dead connections
 				pool.Broadcast(data)
 			case action := <-incorporated:
+				blocks.Append(action)
 				data := []byte{MsgAction}
 				data = append(data, action...)
 				pool.Broadcast(data)
@@ -110,6 +156,11 @@ func NewSingleAuthority(config SingleAuthorityConfig, state ProtocolState) chan
 				cached := socket.NewCachedConnection(req.conn)
 				pool.Add(cached)
 				go blocks.Sync(cached, req.epoch)
+			case <-quit:
+				for _, conn := range pool {
+					conn.Close()
+				}
+				return
 			}
 		}
 
@@ -118,38 +169,73 @@ func NewSingleAuthority(config SingleAuthorityConfig, state ProtocolState) chan
 	// listen outgoing (cached with recent blocks)
 	go func() {
 		for {
-			if conn, err := outgoing.Accept(); err == nil {
-				trustedConn, err := socket.PromoteConnection(conn, config.Credentials, config.ValidateIncoming)
-				if err != nil {
-					conn.Close()
-				}
-				go WaitForOutgoingSyncRequest(trustedConn, newOutgoing)
+			conn, err := outgoing.Accept()
+			if err != nil {
+				authority.Fail(err)
+				return
+			}
+			trustedConn, err := socket.PromoteConnection(conn, key, config.ValidateIncoming)
+			if err != nil {
+				conn.Close()
+			} else {
+				go WaitForOutgoingSyncRequest(trustedConn, newOutgoing, authority.Stopping())
 			}
-
 		}
 	}()
 
-	return finalize
+	return authority, nil
 }
 
-func WaitForOutgoingSyncRequest(conn *socket.SignedConnection, outgoing chan OutgoindConnectionRequest) {
+// WaitForOutgoingSyncRequest hands conn to outgoing once it asks to sync. The
+// connection is shut down if stopping is closed first.
+func WaitForOutgoingSyncRequest(conn *socket.SignedConnection, outgoing chan OutgoindConnectionRequest, stopping <-chan struct{}) {
+	defer ShutdownOnStop(conn, stopping)()
 	data, err := conn.Read()
 	if err != nil || len(data) != 9 || data[0] != MsgSyncRequest {
 		conn.Shutdown()
 		return
 	}
 	epoch, _ := util.ParseUint64(data, 1)
-	outgoing <- OutgoindConnectionRequest{conn: conn, epoch: epoch}
+	select {
+	case outgoing <- OutgoindConnectionRequest{conn: conn, epoch: epoch}:
+	case <-stopping:
+		conn.Shutdown()
+	}
 }
 
-func WaitForProtocolActions(conn *socket.SignedConnection, terminate chan crypto.Token, action chan []byte) {
+// WaitForProtocolActions reads actions submitted on conn. Gateways submit
+// actions to the authority as they would to a breeze node. It returns without
+// waiting for the authority once stopping is closed.
+func WaitForProtocolActions(conn *socket.SignedConnection, terminate chan crypto.Token, action chan []byte, stopping <-chan struct{}) {
 	for {
 		data, err := conn.Read()
-		if err != nil || len(data) < 2 || data[0] != MsgActionSubmit {
+		if err != nil || len(data) < 2 || data[0] != chain.MsgActionSubmit {
+			conn.Shutdown()
+			select {
+			case terminate <- conn.Token:
+			case <-stopping:
+			}
+			return
+		}
+		select {
+		case action <- data[1:]:
+		case <-stopping:
 			conn.Shutdown()
-			terminate <- conn.Token
 			return
 		}
-		action <- data[1:]
 	}
 }
+
+// ShutdownOnStop shuts conn down if stopping is closed before the returned
+// function is called.
+func ShutdownOnStop(conn *socket.SignedConnection, stopping <-chan struct{}) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-stopping:
+			conn.Shutdown()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
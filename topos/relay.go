@@ -1,12 +1,14 @@
 package topos
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
 
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/util"
+	"github.com/freehandle/cb/social"
 
 	"github.com/freehandle/breeze/socket"
 )
@@ -15,7 +17,7 @@ import (
 type RelayConfig struct {
 	SourceAddress string                    // url:port
 	SourceToken   crypto.Token              // known token of the block provider
-	Credentials   crypto.PrivateKey         // secret key of the relay node
+	Credentials   social.Signer             // key of the relay node
 	ListenPort    int                       // other nodes must connect to this port
 	Validate      socket.ValidateConnection // check if a token is allowed
 	Strict        bool                      // all incoming actions must be valid
@@ -27,37 +29,45 @@ type RelaySyncRequest struct {
 	Epoch uint64
 }
 
-func NewRelay(config RelayConfig, chain *Blockchain) chan error {
-
-	finalize := make(chan error, 2)
+func NewRelay(ctx context.Context, config RelayConfig, chain *Blockchain) (*social.Handle, error) {
+	key, err := social.ConnectionKey(config.Credentials)
+	if err != nil {
+		return nil, err
+	}
 
 	listeners, err := net.Listen("tcp", fmt.Sprintf(":%v", config.ListenPort))
 	if err != nil {
-		finalize <- fmt.Errorf("could not listen on port %v: %v", config.ListenPort, err)
-		return finalize
+		return nil, fmt.Errorf("could not listen on port %v: %v", config.ListenPort, err)
 	}
 
-	conn, err := socket.Dial(config.SourceAddress, config.Credentials, config.SourceToken)
+	conn, err := socket.Dial(config.SourceAddress, key, config.SourceToken)
 	if err != nil {
-		finalize <- fmt.Errorf("could not connect to block provider: %v", err)
-		return finalize
+		listeners.Close()
+		return nil, fmt.Errorf("could not connect to block provider: %v", err)
 	}
 
 	if err := conn.Send(NewSyncRequest(chain.state.Epoch())); err != nil {
-		finalize <- fmt.Errorf("could not send sync request: %v", err)
-		return finalize
+		listeners.Close()
+		conn.Shutdown()
+		return nil, fmt.Errorf("could not send sync request: %v", err)
 	}
 
+	handle := social.NewHandle(ctx)
+	handle.Addr = listeners.Addr()
+
 	incorporate := make(chan *RelaySyncRequest)
 	msg := make(chan []byte)
 
 	pool := make(socket.ConnectionPool)
+	readerDone := make(chan struct{})
+	quit := make(chan struct{})
 
 	go func() {
+		defer close(readerDone)
 		for {
 			data, err := conn.Read()
 			if err != nil {
-				finalize <- fmt.Errorf("error reading from block provider: %v", err)
+				handle.Fail(fmt.Errorf("error reading from block provider: %v", err))
 				return
 			}
 			if data[0] == MsgBlock {
@@ -65,7 +75,7 @@ func NewRelay(config RelayConfig, chain *Blockchain) chan error {
 					epoch, position := util.ParseUint64(data, 1)
 					hash, _ := util.ParseHash(data, position)
 					if err := chain.NextBlock(epoch, hash); err != nil {
-						finalize <- fmt.Errorf("error processing new block: %v", err)
+						handle.Fail(fmt.Errorf("error processing new block: %v", err))
 						return
 					} else {
 						msg <- data
@@ -98,37 +108,92 @@ func NewRelay(config RelayConfig, chain *Blockchain) chan error {
 				pool[request.Token] = request.Conn
 				go chain.Sync(request.Conn, request.Epoch)
 			case data := <-msg:
-				pool.Broadcast(append([]byte{MsgBlock}, data...))
+				pool.Broadcast(data)
+			case <-quit:
+				for _, conn := range pool {
+					conn.Close()
+				}
+				return
 			}
 		}
 	}()
 
+	// on stop: disconnect from the block provider, close connections and
+	// flush the chain file.
+	go func() {
+		<-handle.Stopping()
+		listeners.Close()
+		conn.Shutdown()
+		<-readerDone
+		quit <- struct{}{}
+		if err := chain.Close(); err != nil {
+			log.Printf("could not close blockchain: %v", err)
+		}
+		handle.Stopped()
+	}()
+
 	go func() {
 		for {
 			if conn, err := listeners.Accept(); err == nil {
-				trustedConn, err := socket.PromoteConnection(conn, config.Credentials, config.Validate)
+				trustedConn, err := socket.PromoteConnection(conn, key, config.Validate)
 				if err != nil {
 					conn.Close()
 				} else {
 
-					go WaitSyncRequest(trustedConn, incorporate)
+					go WaitRelayRequest(trustedConn, chain, incorporate, handle.Stopping())
 				}
 			} else {
 				return
 			}
 		}
 	}()
-	return finalize
+	return handle, nil
 }
 
-func WaitSyncRequest(conn *socket.SignedConnection, incorporate chan *RelaySyncRequest) {
+func WaitSyncRequest(conn *socket.SignedConnection, incorporate chan *RelaySyncRequest, stopping <-chan struct{}) {
+	defer ShutdownOnStop(conn, stopping)()
 	data, err := conn.Read()
 	if err != nil {
 		conn.Shutdown()
 		return
 	}
-	if data[0] != MsgSyncRequest || len(data) != 9 {
+	syncRequest(conn, data, incorporate, stopping)
+}
+
+// WaitRelayRequest answers balance requests on conn until it asks to sync
+// with the chain. The connection is shut down if stopping is closed first.
+func WaitRelayRequest(conn *socket.SignedConnection, chain *Blockchain, incorporate chan *RelaySyncRequest, stopping <-chan struct{}) {
+	defer ShutdownOnStop(conn, stopping)()
+	for {
+		data, err := conn.Read()
+		if err != nil || len(data) == 0 {
+			conn.Shutdown()
+			return
+		}
+		if data[0] != MsgBalanceRequest {
+			syncRequest(conn, data, incorporate, stopping)
+			return
+		}
+		token, err := ParseBalanceRequest(data)
+		if err != nil {
+			conn.Shutdown()
+			return
+		}
+		reply := append([]byte{MsgSyncError}, []byte("node does not keep balances")...)
+		if balance, ok := chain.Balance(token); ok {
+			reply = balance.Serialize()
+		}
+		if err := conn.Send(reply); err != nil {
+			conn.Shutdown()
+			return
+		}
+	}
+}
+
+func syncRequest(conn *socket.SignedConnection, data []byte, incorporate chan *RelaySyncRequest, stopping <-chan struct{}) {
+	if len(data) != 9 || data[0] != MsgSyncRequest {
 		conn.Shutdown()
+		return
 	}
 	cached := socket.NewCachedConnection(conn)
 	request := RelaySyncRequest{
@@ -136,5 +201,9 @@ func WaitSyncRequest(conn *socket.SignedConnection, incorporate chan *RelaySyncR
 		Token: conn.Token,
 	}
 	request.Epoch, _ = util.ParseUint64(data, 1)
-	incorporate <- &request
+	select {
+	case incorporate <- &request:
+	case <-stopping:
+		conn.Shutdown()
+	}
 }
@@ -13,7 +13,7 @@ type SyncSocialConfig struct {
 	ProviderToken   crypto.Token
 	NodeAddress     string
 	NodeToken       crypto.Token
-	Credentials     crypto.PrivateKey
+	Credentials     social.Signer
 	BlockStore      Chainer
 }
 
@@ -66,13 +66,18 @@ func (b *BlockSorter) AddBlock(block *social.ProtocolBlock) {
 
 func SyncSocial(config SyncSocialConfig) chan error {
 	finalize := make(chan error, 2)
+	key, err := social.ConnectionKey(config.Credentials)
+	if err != nil {
+		finalize <- err
+		return finalize
+	}
 	startSyncEpoch := config.BlockStore.Epoch() + 1
-	oldBlocks, lastEpoch, err := ReceiveBlocks(config.ProviderAddress, config.ProviderToken, config.Credentials, startSyncEpoch)
+	oldBlocks, lastEpoch, err := ReceiveBlocks(config.ProviderAddress, config.ProviderToken, key, startSyncEpoch)
 	if err != nil {
 		finalize <- fmt.Errorf("could not receive blocks: %v", err)
 		return finalize
 	}
-	newBlocks := social.SocialProtocolBlockListener(config.ProviderAddress, config.ProviderToken, config.Credentials, lastEpoch)
+	newBlocks := social.SocialProtocolBlockListener(config.ProviderAddress, config.ProviderToken, key, lastEpoch)
 	go func() {
 		live := true
 		finishedOld := false
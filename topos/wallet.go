@@ -0,0 +1,208 @@
+package topos
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/actions"
+	"github.com/freehandle/breeze/socket"
+)
+
+// Balancer is a ProtocolState that keeps the token balance of wallets. A
+// Blockchain whose state is a Balancer answers balance requests.
+type Balancer interface {
+	Balance(token crypto.Token) (wallet, deposit uint64)
+}
+
+// ActionWindow is the number of epochs after its time stamp during which an
+// action is accepted by Wallets.
+const ActionWindow = 100
+
+// Wallets is a ProtocolState keeping the balance of breeze wallets and their
+// deposits from transfer, deposit, withdraw and void actions. Fees are
+// burned. Actions must be signed by the wallet they debit, time stamped
+// within ActionWindow epochs of the current one and not seen before. It is
+// enough to run a local single authority for tests.
+type Wallets struct {
+	mu       sync.Mutex
+	epoch    uint64
+	balances map[crypto.Token]uint64
+	deposits map[crypto.Token]uint64
+	seen     map[crypto.Hash]uint64 // hash of accepted actions to their time stamp
+}
+
+// NewWallets returns the wallet state at epoch with genesis balances.
+func NewWallets(epoch uint64, genesis map[crypto.Token]uint64) *Wallets {
+	wallets := &Wallets{
+		epoch:    epoch,
+		balances: make(map[crypto.Token]uint64),
+		deposits: make(map[crypto.Token]uint64),
+		seen:     make(map[crypto.Hash]uint64),
+	}
+	for token, balance := range genesis {
+		wallets.balances[token] = balance
+	}
+	return wallets
+}
+
+func (w *Wallets) Epoch() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.epoch
+}
+
+func (w *Wallets) NextBlock(epoch uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if epoch != w.epoch+1 {
+		return errors.New("block out of sequence")
+	}
+	w.epoch = epoch
+	for hash, stamp := range w.seen {
+		if stamp+ActionWindow <= epoch {
+			delete(w.seen, hash)
+		}
+	}
+	return nil
+}
+
+func (w *Wallets) Balance(token crypto.Token) (uint64, uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.balances[token], w.deposits[token]
+}
+
+// debit takes value from the wallet of token.
+func (w *Wallets) debit(token crypto.Token, value uint64) error {
+	if w.balances[token] < value {
+		return errors.New("insufficient funds")
+	}
+	w.balances[token] -= value
+	return nil
+}
+
+// check verifies that data is signed by signer, that its time stamp is within
+// the action window and that it was not seen before.
+func (w *Wallets) check(data []byte, signer crypto.Token, stamp uint64, signature crypto.Signature) error {
+	size := len(crypto.Signature{})
+	if len(data) <= size || !signer.Verify(data[:len(data)-size], signature) {
+		return errors.New("invalid signature")
+	}
+	if stamp > w.epoch || stamp+ActionWindow <= w.epoch {
+		return errors.New("action out of epoch window")
+	}
+	if _, ok := w.seen[crypto.Hasher(data)]; ok {
+		return errors.New("duplicate action")
+	}
+	return nil
+}
+
+func (w *Wallets) Action(data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stamp, err := w.action(data)
+	if err != nil {
+		return err
+	}
+	w.seen[crypto.Hasher(data)] = stamp
+	return nil
+}
+
+// action applies data to the wallets and returns its time stamp.
+func (w *Wallets) action(data []byte) (uint64, error) {
+	switch actions.Kind(data) {
+	case actions.ITransfer:
+		transfer := actions.ParseTransfer(data)
+		if transfer == nil {
+			return 0, errors.New("invalid transfer")
+		}
+		if err := w.check(data, transfer.From, transfer.TimeStamp, transfer.Signature); err != nil {
+			return 0, err
+		}
+		total := transfer.Fee
+		for _, to := range transfer.To {
+			if total+to.Value < total {
+				return 0, errors.New("transfer value overflow")
+			}
+			total += to.Value
+		}
+		if err := w.debit(transfer.From, total); err != nil {
+			return 0, err
+		}
+		for _, to := range transfer.To {
+			w.balances[to.Token] += to.Value
+		}
+		return transfer.TimeStamp, nil
+	case actions.IDeposit:
+		deposit := actions.ParseDeposit(data)
+		if deposit == nil {
+			return 0, errors.New("invalid deposit")
+		}
+		if err := w.check(data, deposit.Token, deposit.TimeStamp, deposit.Signature); err != nil {
+			return 0, err
+		}
+		if deposit.Value+deposit.Fee < deposit.Value {
+			return 0, errors.New("deposit value overflow")
+		}
+		if err := w.debit(deposit.Token, deposit.Value+deposit.Fee); err != nil {
+			return 0, err
+		}
+		w.deposits[deposit.Token] += deposit.Value
+		return deposit.TimeStamp, nil
+	case actions.IWithdraw:
+		withdraw := actions.ParseWithdraw(data)
+		if withdraw == nil {
+			return 0, errors.New("invalid withdraw")
+		}
+		if err := w.check(data, withdraw.Token, withdraw.TimeStamp, withdraw.Signature); err != nil {
+			return 0, err
+		}
+		if w.deposits[withdraw.Token] < withdraw.Value {
+			return 0, errors.New("insufficient deposit")
+		}
+		if w.balances[withdraw.Token]+withdraw.Value < withdraw.Fee {
+			return 0, errors.New("insufficient funds")
+		}
+		w.deposits[withdraw.Token] -= withdraw.Value
+		w.balances[withdraw.Token] = w.balances[withdraw.Token] + withdraw.Value - withdraw.Fee
+		return withdraw.TimeStamp, nil
+	case actions.IVoid:
+		void := actions.ParseVoid(data)
+		if void == nil {
+			return 0, errors.New("invalid void")
+		}
+		if err := w.check(data, void.Wallet, void.TimeStamp, void.Signature); err != nil {
+			return 0, err
+		}
+		return void.TimeStamp, w.debit(void.Wallet, void.Fee)
+	default:
+		return 0, errors.New("unknown action")
+	}
+}
+
+// RequestBalance asks the relay or index node at address for the balance of
+// wallet.
+func RequestBalance(address string, node crypto.Token, credentials crypto.PrivateKey, wallet crypto.Token) (*Balance, error) {
+	conn, err := socket.Dial(address, credentials, node)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to node: %v", err)
+	}
+	defer conn.Shutdown()
+	if err := conn.Send(NewBalanceRequest(wallet)); err != nil {
+		return nil, fmt.Errorf("could not send balance request: %v", err)
+	}
+	data, err := conn.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read balance: %v", err)
+	}
+	if len(data) > 0 && data[0] == MsgSyncError {
+		return nil, fmt.Errorf("node refused balance request: %s", data[1:])
+	}
+	balance := ParseBalance(data)
+	if balance == nil || balance.Token != wallet {
+		return nil, errors.New("invalid balance reply")
+	}
+	return balance, nil
+}
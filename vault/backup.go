@@ -0,0 +1,149 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// Backup bundle layout:
+//
+//	"cbb" | version (1 byte) | N, R, P (uint32 each) | salt (32 bytes) | sealed
+//
+// The sealed payload is the number of records (uint32) followed by every
+// record not revoked, each as a byte array, in vault file order. It is sealed
+// with a cipher derived from an export passphrase independent of the vault
+// passphrase.
+var bundleMagic = []byte{'c', 'b', 'b', 1}
+
+// ExportBundle returns every key entry and stage secrets of the vault not
+// revoked as a portable bundle encrypted under password.
+func (vault *SecureVault) ExportBundle(password []byte) ([]byte, error) {
+	vault.mu.Lock()
+	records := vault.liveRecords()
+	vault.mu.Unlock()
+	head, err := newHeader(DefaultKDF)
+	if err != nil {
+		return nil, err
+	}
+	key, err := head.KDF.Key(password, head.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("could not derive cipher key: %v", err)
+	}
+	payload := make([]byte, 0)
+	util.PutUint32(uint32(len(records)), &payload)
+	for _, record := range records {
+		util.PutByteArray(record, &payload)
+	}
+	data := append([]byte{}, bundleMagic...)
+	util.PutUint32(uint32(head.KDF.N), &data)
+	util.PutUint32(uint32(head.KDF.R), &data)
+	util.PutUint32(uint32(head.KDF.P), &data)
+	data = append(data, head.Salt...)
+	return append(data, crypto.CipherFromKey(key).Seal(payload)...), nil
+}
+
+// openBundle returns the records of a bundle. The first record is always the
+// SecretKey of the exporting vault.
+func openBundle(bundle, password []byte) ([][]byte, error) {
+	if len(bundle) < len(bundleMagic)+12+saltSize || !bytes.Equal(bundle[:len(bundleMagic)], bundleMagic) {
+		return nil, errors.New("invalid vault bundle")
+	}
+	cost, position := util.ParseUint32(bundle, len(bundleMagic))
+	r, position := util.ParseUint32(bundle, position)
+	p, position := util.ParseUint32(bundle, position)
+	kdf := KDFParams{N: int(cost), R: int(r), P: int(p)}
+	if err := kdf.Check(); err != nil {
+		return nil, fmt.Errorf("invalid vault bundle: %v", err)
+	}
+	salt := bundle[position : position+saltSize]
+	key, err := kdf.Key(password, salt)
+	if err != nil {
+		return nil, fmt.Errorf("could not derive cipher key: %v", err)
+	}
+	payload, err := crypto.CipherFromKey(key).Open(bundle[position+saltSize:])
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	count, position := util.ParseUint32(payload, 0)
+	records := make([][]byte, 0, count)
+	for n := 0; n < int(count); n++ {
+		var record []byte
+		record, position = util.ParseByteArray(payload, position)
+		if _, ok := recordToken(record); !ok {
+			return nil, fmt.Errorf("%w: bundle record %v", ErrCorruptedRecord, n)
+		}
+		records = append(records, record)
+	}
+	if position != len(payload) || len(records) == 0 || records[0][0] == TypeStageSecrets {
+		return nil, fmt.Errorf("%w: invalid bundle payload", ErrCorruptedRecord)
+	}
+	return records, nil
+}
+
+// ImportBundle incorporates into the vault every key entry and stage secrets
+// of a bundle not already on the vault, and returns how many were imported.
+// The SecretKey of the exporting vault is imported as an unlabeled key. If
+// any label of the bundle is in use by another key nothing is imported.
+func (vault *SecureVault) ImportBundle(bundle, password []byte) (int, error) {
+	records, err := openBundle(bundle, password)
+	if err != nil {
+		return 0, err
+	}
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	imported := make([][]byte, 0)
+	for n, record := range records {
+		token, _ := recordToken(record)
+		if vault.hasToken(token) {
+			continue
+		}
+		label := ""
+		if record[0] == TypeStageSecrets {
+			label = ParseStageEntry(record).Label
+		} else if n == 0 {
+			entry := ParseEntry(record)
+			entry.Label = ""
+			entry.Purpose = "imported vault secret key"
+			record = entry.Serialize()
+		} else {
+			label = ParseEntry(record).Label
+		}
+		if label != "" && vault.labelInUse(label) {
+			return 0, fmt.Errorf("label %v already in use", label)
+		}
+		imported = append(imported, record)
+	}
+	for _, record := range imported {
+		if err := vault.appendRecord(record); err != nil {
+			return 0, err
+		}
+		vault.load(record)
+	}
+	return len(imported), nil
+}
+
+// RestoreBundle creates a new vault file protected by password with every key
+// entry and stage secrets of a bundle. The SecretKey of the new vault is the
+// SecretKey of the exporting vault.
+func RestoreBundle(bundle, exportPassword, password []byte, fileName string) (*SecureVault, error) {
+	records, err := openBundle(bundle, exportPassword)
+	if err != nil {
+		return nil, err
+	}
+	vault, err := createSecureVault(password, fileName, ParseEntry(records[0]))
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records[1:] {
+		if err := vault.appendRecord(record); err != nil {
+			vault.Close()
+			return nil, err
+		}
+		vault.load(record)
+	}
+	return vault, nil
+}
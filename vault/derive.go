@@ -0,0 +1,48 @@
+package vault
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/freehandle/breeze/crypto"
+)
+
+// DeriveKey derives a child key from the seed of master by a path of
+// segments separated by slashes, such as "synergy/attorney/0". Each segment
+// derives a new seed and chain code from the previous ones with HMAC-SHA512,
+// so the same master and path always give the same key, and a child key
+// reveals nothing about its parent or siblings.
+func DeriveKey(master crypto.PrivateKey, path string) (crypto.PrivateKey, error) {
+	segments := strings.Split(path, "/")
+	for _, segment := range segments {
+		if segment == "" {
+			return crypto.PrivateKey{}, fmt.Errorf("invalid derivation path: %q", path)
+		}
+		if len(segment) > MaxLabelSize {
+			return crypto.PrivateKey{}, errors.New("derivation path segment too long")
+		}
+	}
+	mac := hmac.New(sha512.New, []byte("freehandle vault key derivation"))
+	mac.Write(master[:seedSize])
+	node := mac.Sum(nil)
+	for _, segment := range segments {
+		mac := hmac.New(sha512.New, node[seedSize:])
+		mac.Write([]byte{0})
+		mac.Write(node[:seedSize])
+		mac.Write([]byte(segment))
+		node = mac.Sum(nil)
+	}
+	var key crypto.PrivateKey
+	copy(key[:], ed25519.NewKeyFromSeed(node[:seedSize]))
+	return key, nil
+}
+
+// DeriveKey derives a child key from the vault SecretKey. Derived keys are
+// not stored on the vault: they are recovered with the SecretKey alone.
+func (vault *SecureVault) DeriveKey(path string) (crypto.PrivateKey, error) {
+	return DeriveKey(vault.SecretKey, path)
+}
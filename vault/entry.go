@@ -0,0 +1,58 @@
+package vault
+
+import (
+	"time"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// MaxLabelSize is the maximum length in bytes of entry labels and purposes.
+const MaxLabelSize = 255
+
+// VaultKeyLabel is the label of the entry holding the vault own SecretKey.
+const VaultKeyLabel = "vault"
+
+const keySize = len(crypto.PrivateKey{})
+
+// Entry is a private key stored in the vault together with its type, a human
+// readable label, the purpose it serves and the time it was created. Entries
+// of legacy vaults carry no label, no purpose and zero creation time.
+type Entry struct {
+	Type    byte
+	Label   string
+	Purpose string
+	Created time.Time
+	Key     crypto.PrivateKey
+}
+
+func (e *Entry) Token() crypto.Token {
+	return e.Key.PublicKey()
+}
+
+func (e *Entry) Serialize() []byte {
+	data := []byte{e.Type}
+	data = append(data, e.Key[:]...)
+	util.PutString(e.Label, &data)
+	util.PutString(e.Purpose, &data)
+	util.PutUint64(uint64(e.Created.Unix()), &data)
+	return data
+}
+
+func ParseEntry(data []byte) *Entry {
+	if len(data) < 1+keySize {
+		return nil
+	}
+	entry := Entry{Type: data[0]}
+	copy(entry.Key[:], data[1:1+keySize])
+	position := 1 + keySize
+	entry.Label, position = util.ParseString(data, position)
+	entry.Purpose, position = util.ParseString(data, position)
+	var created uint64
+	created, position = util.ParseUint64(data, position)
+	if position != len(data) {
+		return nil
+	}
+	entry.Created = time.Unix(int64(created), 0)
+	return &entry
+}
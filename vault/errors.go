@@ -0,0 +1,22 @@
+package vault
+
+import "errors"
+
+var (
+	// ErrWrongPassphrase is returned when the vault records cannot be opened
+	// with the cipher derived from the given passphrase.
+	ErrWrongPassphrase = errors.New("wrong vault passphrase")
+	// ErrTruncatedTail is returned when the vault file ends in the middle of
+	// the header or of its first record. Later torn records are repaired.
+	ErrTruncatedTail = errors.New("vault file truncated")
+	// ErrCorruptedRecord is returned when a vault record cannot be decrypted
+	// or parsed even though the passphrase is correct, when the vault ends
+	// before the records its tip accounts for, or when its header carries
+	// scrypt parameters out of bounds.
+	ErrCorruptedRecord = errors.New("vault record corrupted")
+	// ErrUnsupportedVersion is returned when the vault file was written by a
+	// newer format version than this package knows.
+	ErrUnsupportedVersion = errors.New("unsupported vault version")
+	// ErrIO wraps every failure to read, write or sync the vault file.
+	ErrIO = errors.New("vault i/o failure")
+)
@@ -0,0 +1,301 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// Vault file layout (version 4):
+//
+//	header:  "cbv" | version (1 byte) | N, R, P (uint32 each) | salt (32 bytes)
+//	tips:    two slots of record count (uint32) | tip tag (32 bytes)
+//	records: length (uint16) | sealed record | chain tag (32 bytes)
+//
+// The chain tag of a record is the HMAC-SHA256, keyed by a key derived from
+// the vault cipher key, of the previous chain tag followed by the sealed
+// record. The chain starts with the tag of the header. Dropping, reordering
+// or replacing records, or changing the header, breaks the chain.
+//
+// A tip binds a number of records to the chain tag of the last of them, so
+// that removal of trailing records is detected as well. After every append the
+// tip of the new count is written in place on slot count%2, leaving the tip of
+// the previous count on the other slot. A crash before or during that write
+// leaves records beyond the newest authentic tip, which are authenticated by
+// the chain and accepted. A vault with a single authentic tip and no record
+// beyond it was truncated and is rejected. Only a rollback of the whole file
+// to an earlier state goes undetected.
+//
+// Version 3 files have a single tip slot. Version 2 files have no tip.
+// Version 1 files have the same header but untagged records framed by a zero
+// byte and a two-byte length. Legacy files (version 0) have no header at all
+// and start directly with the salt. A legacy salt starting with the magic
+// bytes is possible, but with negligible probability. Older versions are
+// migrated to version 4 when opened; newer versions are rejected with
+// ErrUnsupportedVersion.
+const (
+	legacyVersion  byte = 0
+	chainedVersion byte = 2
+	tipVersion     byte = 3
+	twinTipVersion byte = 4
+	saltSize            = 32
+	tagSize             = sha256.Size
+	tipSize             = 4 + tagSize
+)
+
+var headerMagic = []byte{'c', 'b', 'v'}
+
+// header is the plain text prefix of the vault file.
+type header struct {
+	Version byte
+	KDF     KDFParams
+	Salt    []byte
+}
+
+func (h *header) Serialize() []byte {
+	data := append([]byte{}, headerMagic...)
+	data = append(data, h.Version)
+	util.PutUint32(uint32(h.KDF.N), &data)
+	util.PutUint32(uint32(h.KDF.R), &data)
+	util.PutUint32(uint32(h.KDF.P), &data)
+	return append(data, h.Salt...)
+}
+
+func newHeader(kdf KDFParams) (*header, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("could not generate salt: %v", err)
+	}
+	return &header{Version: twinTipVersion, KDF: kdf, Salt: salt}, nil
+}
+
+// readHeader reads the vault file header. Files without magic are legacy and
+// their header is only the salt with DefaultKDF parameters.
+func readHeader(file io.Reader) (*header, error) {
+	magic := make([]byte, len(headerMagic)+1)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return nil, readError(err)
+	}
+	version := magic[len(headerMagic)]
+	if !bytes.Equal(magic[:len(headerMagic)], headerMagic) || version == legacyVersion {
+		salt := make([]byte, saltSize-len(magic))
+		if _, err := io.ReadFull(file, salt); err != nil {
+			return nil, readError(err)
+		}
+		return &header{Version: legacyVersion, KDF: DefaultKDF, Salt: append(magic, salt...)}, nil
+	}
+	if version > twinTipVersion {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedVersion, version)
+	}
+	data := make([]byte, 12+saltSize)
+	if _, err := io.ReadFull(file, data); err != nil {
+		return nil, readError(err)
+	}
+	h := header{Version: version}
+	n, position := util.ParseUint32(data, 0)
+	r, position := util.ParseUint32(data, position)
+	p, position := util.ParseUint32(data, position)
+	h.KDF = KDFParams{N: int(n), R: int(r), P: int(p)}
+	if err := h.KDF.Check(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptedRecord, err)
+	}
+	h.Salt = data[position:]
+	return &h, nil
+}
+
+// chainKey derives the key of the record chain from the vault cipher key.
+func chainKey(cipherKey []byte) []byte {
+	mac := hmac.New(sha256.New, cipherKey)
+	mac.Write([]byte("freehandle vault record chain"))
+	return mac.Sum(nil)
+}
+
+func chainTag(key, previous, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(previous)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// tipTag authenticates count as the number of records of a vault whose last
+// record has the given chain tag.
+func tipTag(key, chain []byte, count uint32) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("tip"))
+	data := make([]byte, 0, 4)
+	util.PutUint32(count, &data)
+	mac.Write(data)
+	mac.Write(chain)
+	return mac.Sum(nil)
+}
+
+func frameTip(key, chain []byte, count uint32) []byte {
+	data := make([]byte, 0, tipSize)
+	util.PutUint32(count, &data)
+	return append(data, tipTag(key, chain, count)...)
+}
+
+// frameTips returns both tip slots of a vault with count records, the last of
+// them with chain tag chain and the one before with chain tag previous.
+func frameTips(key, previous, chain []byte, count uint32) []byte {
+	if count == 0 {
+		return append(frameTip(key, chain, 0), frameTip(key, chain, 0)...)
+	}
+	slots := [][]byte{frameTip(key, previous, count-1), frameTip(key, chain, count)}
+	if count%2 == 1 {
+		return append(slots[0], slots[1]...)
+	}
+	return append(slots[1], slots[0]...)
+}
+
+// readTip reads the record count and tip tag of a tip slot.
+func readTip(file io.Reader) (uint32, []byte, error) {
+	data := make([]byte, tipSize)
+	if _, err := io.ReadFull(file, data); err != nil {
+		return 0, nil, readError(err)
+	}
+	count, position := util.ParseUint32(data, 0)
+	return count, data[position:], nil
+}
+
+func frameRecord(sealed, tag []byte) []byte {
+	withLen := []byte{byte(len(sealed)), byte(len(sealed) >> 8)}
+	withLen = append(withLen, sealed...)
+	return append(withLen, tag...)
+}
+
+// readRecord reads the next sealed record of a vault file of the given
+// version, together with its chain tag for version 2 files. It returns io.EOF
+// only if there are no more records and ErrTruncatedTail if the file ends in
+// the middle of a record.
+func readRecord(file io.Reader, version byte) (sealed, tag []byte, legacy bool, err error) {
+	if version < chainedVersion {
+		sealed, legacy, err = readUntaggedRecord(file)
+		return sealed, nil, legacy, err
+	}
+	size := make([]byte, 2)
+	if _, err := io.ReadFull(file, size); err == io.EOF {
+		return nil, nil, false, io.EOF
+	} else if err != nil {
+		return nil, nil, false, readError(err)
+	}
+	sealed = make([]byte, int(size[0])|int(size[1])<<8)
+	if _, err := io.ReadFull(file, sealed); err != nil {
+		return nil, nil, false, readError(err)
+	}
+	tag = make([]byte, tagSize)
+	if _, err := io.ReadFull(file, tag); err != nil {
+		return nil, nil, false, readError(err)
+	}
+	return sealed, tag, false, nil
+}
+
+// readUntaggedRecord reads records of version 1 and legacy files. Legacy
+// records hold a bare private key and are prefixed by a single non-zero
+// length byte. Version 1 records are prefixed by a zero byte and a two-byte
+// little endian length.
+func readUntaggedRecord(file io.Reader) (sealed []byte, legacy bool, err error) {
+	size := make([]byte, 1)
+	if _, err := io.ReadFull(file, size); err == io.EOF {
+		return nil, false, io.EOF
+	} else if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrIO, err)
+	}
+	length := int(size[0])
+	if length == 0 {
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(file, extended); err != nil {
+			return nil, false, readError(err)
+		}
+		length = int(extended[0]) | int(extended[1])<<8
+	}
+	sealed = make([]byte, length)
+	if _, err := io.ReadFull(file, sealed); err != nil {
+		return nil, false, readError(err)
+	}
+	return sealed, size[0] != 0, nil
+}
+
+func readError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncatedTail
+	}
+	return fmt.Errorf("%w: %v", ErrIO, err)
+}
+
+func writeAll(file io.Writer, data []byte) error {
+	n, err := file.Write(data)
+	if err == nil && n != len(data) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrIO, err)
+	}
+	return nil
+}
+
+// rewrite writes every record of the vault under head and cipher key and
+// replaces the vault with them. On a vault file the replacement is atomic, so
+// that a crash midway leaves the vault file as it was.
+func (vault *SecureVault) rewrite(head *header, key []byte) error {
+	cipher := crypto.CipherFromKey(key)
+	chainer := chainKey(key)
+	data := head.Serialize()
+	chain := chainTag(chainer, nil, data)
+	var previous []byte
+	records := make([]byte, 0)
+	for _, record := range vault.records {
+		sealed := cipher.Seal(record)
+		previous, chain = chain, chainTag(chainer, chain, sealed)
+		records = append(records, frameRecord(sealed, chain)...)
+	}
+	data = append(data, frameTips(chainer, previous, chain, uint32(len(vault.records)))...)
+	data = append(data, records...)
+	if err := vault.store.Replace(data); err != nil {
+		return err
+	}
+	vault.size = int64(len(data))
+	vault.cipher = cipher
+	vault.chainer = chainer
+	vault.chain = chain
+	vault.previous = previous
+	vault.behind = false
+	vault.head = head
+	vault.key = key
+	return nil
+}
+
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("%w: could not create file: %v", ErrIO, err)
+	}
+	if err := writeAll(file, data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("%w: could not sync file: %v", ErrIO, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("%w: %v", ErrIO, err)
+	}
+	return nil
+}
+
+// syncDir makes a rename durable. Not every platform supports it, so failures
+// are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
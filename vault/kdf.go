@@ -0,0 +1,75 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/freehandle/breeze/crypto/scrypt"
+)
+
+// KDFParams are the scrypt cost parameters used to derive the vault cipher
+// key from its passphrase.
+type KDFParams struct {
+	N int
+	R int
+	P int
+}
+
+// DefaultKDF are the parameters of vaults created before they were stored on
+// the vault file.
+var DefaultKDF = KDFParams{N: 32768, R: 8, P: 1}
+
+// Limits on the scrypt parameters accepted from a vault file or bundle, so
+// that a crafted header cannot make key derivation exhaust memory or time.
+const (
+	maxKDFN      = 1 << 20
+	maxKDFR      = 32
+	maxKDFP      = 16
+	maxKDFMemory = 1 << 30
+)
+
+// Check returns an error if the parameters are not usable by scrypt or exceed
+// the accepted limits.
+func (k KDFParams) Check() error {
+	if k.N < 2 || k.N&(k.N-1) != 0 || k.N > maxKDFN {
+		return fmt.Errorf("invalid scrypt N %v: must be a power of two up to %v", k.N, maxKDFN)
+	}
+	if k.R < 1 || k.R > maxKDFR {
+		return fmt.Errorf("invalid scrypt r %v: must be between 1 and %v", k.R, maxKDFR)
+	}
+	if k.P < 1 || k.P > maxKDFP {
+		return fmt.Errorf("invalid scrypt p %v: must be between 1 and %v", k.P, maxKDFP)
+	}
+	if 128*k.R*k.N > maxKDFMemory {
+		return errors.New("scrypt parameters require too much memory")
+	}
+	return nil
+}
+
+func (k KDFParams) Key(password, salt []byte) ([]byte, error) {
+	if err := k.Check(); err != nil {
+		return nil, err
+	}
+	return scrypt.Key(password, salt, k.N, k.R, k.P, 32)
+}
+
+// Rekey re-derives the vault cipher from a new passphrase and, if kdf is not
+// nil, new scrypt parameters. Every record is sealed again with the new
+// cipher and the vault file is atomically replaced.
+func (vault *SecureVault) Rekey(password []byte, kdf *KDFParams) error {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	params := vault.head.KDF
+	if kdf != nil {
+		params = *kdf
+	}
+	head, err := newHeader(params)
+	if err != nil {
+		return err
+	}
+	key, err := params.Key(password, head.Salt)
+	if err != nil {
+		return fmt.Errorf("could not derive cipher key: %v", err)
+	}
+	return vault.rewrite(head, key)
+}
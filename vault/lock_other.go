@@ -0,0 +1,23 @@
+//go:build !unix
+
+package vault
+
+import (
+	"fmt"
+	"os"
+)
+
+// lockFile creates the side file path.lock exclusively, as advisory locks are
+// not available. A lock left by a crash must be removed by hand.
+func lockFile(path string) (*os.File, error) {
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_EXCL|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("%w: vault in use by another process: %v", ErrIO, err)
+	}
+	return lock, nil
+}
+
+func unlockFile(lock *os.File) {
+	lock.Close()
+	os.Remove(lock.Name())
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package vault
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on the side file path.lock, held until the
+// returned file is closed. It fails at once if another process holds it. The
+// lock is not taken on the vault file itself, which is replaced on rewrite.
+func lockFile(path string) (*os.File, error) {
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not open vault lock: %v", ErrIO, err)
+	}
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("%w: vault in use by another process: %v", ErrIO, err)
+	}
+	return lock, nil
+}
+
+func unlockFile(lock *os.File) {
+	lock.Close()
+}
@@ -0,0 +1,68 @@
+package vault
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/freehandle/breeze/crypto"
+)
+
+const seedSize = ed25519.SeedSize
+
+// MnemonicFromKey encodes the seed of key as a phrase of one word for each
+// seed byte followed by a checksum word.
+func MnemonicFromKey(key crypto.PrivateKey) string {
+	seed := key[:seedSize]
+	words := make([]string, 0, seedSize+1)
+	for _, b := range seed {
+		words = append(words, wordlist[b])
+	}
+	checksum := sha256.Sum256(seed)
+	words = append(words, wordlist[checksum[0]])
+	return strings.Join(words, " ")
+}
+
+// KeyFromMnemonic recovers the private key encoded by MnemonicFromKey.
+func KeyFromMnemonic(phrase string) (crypto.PrivateKey, error) {
+	words := strings.Fields(strings.ToLower(phrase))
+	if len(words) != seedSize+1 {
+		return crypto.PrivateKey{}, fmt.Errorf("mnemonic must have %v words, got %v", seedSize+1, len(words))
+	}
+	values := make(map[string]byte, len(wordlist))
+	for n, word := range wordlist {
+		values[word] = byte(n)
+	}
+	seed := make([]byte, 0, seedSize+1)
+	for _, word := range words {
+		value, ok := values[word]
+		if !ok {
+			return crypto.PrivateKey{}, fmt.Errorf("unknown mnemonic word: %v", word)
+		}
+		seed = append(seed, value)
+	}
+	checksum := sha256.Sum256(seed[:seedSize])
+	if checksum[0] != seed[seedSize] {
+		return crypto.PrivateKey{}, errors.New("mnemonic checksum does not match")
+	}
+	var key crypto.PrivateKey
+	copy(key[:], ed25519.NewKeyFromSeed(seed[:seedSize]))
+	return key, nil
+}
+
+// Mnemonic returns the phrase from which the vault SecretKey can be recovered.
+func (vault *SecureVault) Mnemonic() string {
+	return MnemonicFromKey(vault.SecretKey)
+}
+
+// RecoverSecureVault creates a new vault file protected by password whose
+// SecretKey is recovered from a mnemonic phrase.
+func RecoverSecureVault(password []byte, fileName string, phrase string) (*SecureVault, error) {
+	secret, err := KeyFromMnemonic(phrase)
+	if err != nil {
+		return nil, err
+	}
+	return createSecureVault(password, fileName, newVaultEntry(secret))
+}
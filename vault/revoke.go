@@ -0,0 +1,122 @@
+package vault
+
+import (
+	"errors"
+	"time"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// revocation is a tombstone record. Every record preceding it and identified
+// by the revoked token is no longer available on the vault.
+type revocation struct {
+	Token   crypto.Token
+	Revoked time.Time
+}
+
+func (r *revocation) Serialize() []byte {
+	data := []byte{TypeRevocation}
+	util.PutToken(r.Token, &data)
+	util.PutUint64(uint64(r.Revoked.Unix()), &data)
+	return data
+}
+
+func parseRevocation(data []byte) *revocation {
+	if len(data) == 0 || data[0] != TypeRevocation {
+		return nil
+	}
+	var r revocation
+	position := 1
+	r.Token, position = util.ParseToken(data, position)
+	var revoked uint64
+	revoked, position = util.ParseUint64(data, position)
+	if position != len(data) {
+		return nil
+	}
+	r.Revoked = time.Unix(int64(revoked), 0)
+	return &r
+}
+
+// RevokeKey appends a tombstone for the key entry associated to token. The key
+// is no longer returned by the vault, nor present on Secrets, now or after
+// reopening. The vault SecretKey cannot be revoked.
+func (vault *SecureVault) RevokeKey(token crypto.Token) error {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	if token == vault.SecretKey.PublicKey() {
+		return errors.New("cannot revoke vault secret key")
+	}
+	for _, entry := range vault.entries {
+		if entry.Token() == token {
+			if err := vault.appendRecord((&revocation{Token: token, Revoked: time.Now()}).Serialize()); err != nil {
+				return err
+			}
+			vault.revoke(token)
+			return nil
+		}
+	}
+	return errors.New("key not found")
+}
+
+// Compact rewrites the vault file without tombstones and without the records
+// they revoked. The vault file is atomically replaced.
+func (vault *SecureVault) Compact() error {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	all := vault.records
+	compacted := vault.liveRecords()
+	vault.records = compacted
+	if err := vault.rewrite(vault.head, vault.key); err != nil {
+		vault.records = all
+		return err
+	}
+	return nil
+}
+
+// liveRecords returns the records of key entries and stage secrets not
+// revoked, in file order. A key revoked and imported again is live only on
+// its last record.
+func (vault *SecureVault) liveRecords() [][]byte {
+	last := make(map[crypto.Token]int)
+	for n, record := range vault.records {
+		if token, ok := recordToken(record); ok {
+			last[token] = n
+		}
+	}
+	live := make(map[int]struct{})
+	for _, entry := range vault.entries {
+		live[last[entry.Token()]] = struct{}{}
+	}
+	for _, stage := range vault.stages {
+		live[last[stage.Token()]] = struct{}{}
+	}
+	records := make([][]byte, 0, len(live))
+	for n, record := range vault.records {
+		if _, ok := live[n]; ok {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// recordToken returns the token identifying the key entry or stage secrets
+// of a record. Tombstones are not identified by a token of their own.
+func recordToken(record []byte) (crypto.Token, bool) {
+	if len(record) == 0 {
+		return crypto.Token{}, false
+	}
+	switch record[0] {
+	case TypeRevocation:
+		return crypto.Token{}, false
+	case TypeStageSecrets:
+		if stage := ParseStageEntry(record); stage != nil {
+			return stage.Token(), true
+		}
+	default:
+		if entry := ParseEntry(record); entry != nil {
+			return entry.Token(), true
+		}
+	}
+	return crypto.Token{}, false
+}
@@ -0,0 +1,143 @@
+package vault
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// StageEntry is a bundle of stage secrets stored in the vault. It is
+// identified by the token of its ownership key.
+type StageEntry struct {
+	Label   string
+	Purpose string
+	Created time.Time
+	Secrets StageSecrets
+}
+
+func (s *StageEntry) Token() crypto.Token {
+	return s.Secrets.Ownership.PublicKey()
+}
+
+func (s *StageEntry) Serialize() []byte {
+	data := []byte{TypeStageSecrets}
+	data = append(data, s.Secrets.Ownership[:]...)
+	data = append(data, s.Secrets.Moderation[:]...)
+	data = append(data, s.Secrets.Submission[:]...)
+	util.PutByteArray(s.Secrets.CipherKey, &data)
+	util.PutString(s.Label, &data)
+	util.PutString(s.Purpose, &data)
+	util.PutUint64(uint64(s.Created.Unix()), &data)
+	return data
+}
+
+func ParseStageEntry(data []byte) *StageEntry {
+	if len(data) < 1+3*keySize || data[0] != TypeStageSecrets {
+		return nil
+	}
+	var stage StageEntry
+	position := 1
+	for _, key := range []*crypto.PrivateKey{&stage.Secrets.Ownership, &stage.Secrets.Moderation, &stage.Secrets.Submission} {
+		copy(key[:], data[position:position+keySize])
+		position += keySize
+	}
+	stage.Secrets.CipherKey, position = util.ParseByteArray(data, position)
+	stage.Label, position = util.ParseString(data, position)
+	stage.Purpose, position = util.ParseString(data, position)
+	var created uint64
+	created, position = util.ParseUint64(data, position)
+	if position != len(data) {
+		return nil
+	}
+	stage.Created = time.Unix(int64(created), 0)
+	return &stage
+}
+
+// NewStageSecrets generates random ownership, moderation and submission keys
+// and a random cipher key, and stores them on the vault under label.
+func (vault *SecureVault) NewStageSecrets(label, purpose string) (*StageSecrets, error) {
+	if label == "" {
+		return nil, errors.New("label cannot be empty")
+	}
+	if len(label) > MaxLabelSize || len(purpose) > MaxLabelSize {
+		return nil, errors.New("label or purpose too long")
+	}
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	if vault.labelInUse(label) {
+		return nil, errors.New("label already in use")
+	}
+	stage := StageEntry{Label: label, Purpose: purpose, Created: time.Now()}
+	_, stage.Secrets.Ownership = crypto.RandomAsymetricKey()
+	_, stage.Secrets.Moderation = crypto.RandomAsymetricKey()
+	_, stage.Secrets.Submission = crypto.RandomAsymetricKey()
+	stage.Secrets.CipherKey = make([]byte, 32)
+	if _, err := rand.Read(stage.Secrets.CipherKey); err != nil {
+		return nil, fmt.Errorf("could not generate cipher key: %v", err)
+	}
+	if err := vault.appendRecord(stage.Serialize()); err != nil {
+		return nil, err
+	}
+	vault.stages = append(vault.stages, &stage)
+	secrets := stage.Secrets
+	return &secrets, nil
+}
+
+// StageEntries returns a copy of every stage secrets bundle not revoked, in
+// the order they were stored.
+func (vault *SecureVault) StageEntries() []StageEntry {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	stages := make([]StageEntry, len(vault.stages))
+	for n, stage := range vault.stages {
+		stages[n] = *stage
+	}
+	return stages
+}
+
+// StageSecretsByLabel returns the stage secrets stored under label.
+func (vault *SecureVault) StageSecretsByLabel(label string) (*StageSecrets, bool) {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	for _, stage := range vault.stages {
+		if stage.Label == label {
+			secrets := stage.Secrets
+			return &secrets, true
+		}
+	}
+	return nil, false
+}
+
+// StageSecretsByToken returns the stage secrets with ownership token.
+func (vault *SecureVault) StageSecretsByToken(token crypto.Token) (*StageSecrets, bool) {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	for _, stage := range vault.stages {
+		if stage.Token() == token {
+			secrets := stage.Secrets
+			return &secrets, true
+		}
+	}
+	return nil, false
+}
+
+// RevokeStageSecrets appends a tombstone for the stage secrets with ownership
+// token. They are no longer returned by the vault, now or after reopening.
+func (vault *SecureVault) RevokeStageSecrets(token crypto.Token) error {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	for _, stage := range vault.stages {
+		if stage.Token() == token {
+			if err := vault.appendRecord((&revocation{Token: token, Revoked: time.Now()}).Serialize()); err != nil {
+				return err
+			}
+			vault.revoke(token)
+			return nil
+		}
+	}
+	return errors.New("stage secrets not found")
+}
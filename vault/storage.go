@@ -0,0 +1,299 @@
+package vault
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+	"github.com/freehandle/papirus"
+)
+
+// storage persists the bytes of a vault: its header followed by its records.
+type storage interface {
+	ReadAll() ([]byte, error)
+	WriteAt(offset int64, data []byte) error
+	Truncate(size int64) error
+	Sync() error
+	Replace(data []byte) error // replaces every byte, atomically if possible
+	Close() error
+}
+
+// fileStorage keeps the vault on a file of its own. It holds an exclusive
+// lock on the vault while open, so that two processes never append to the
+// same vault.
+type fileStorage struct {
+	path string
+	file *os.File
+	lock *os.File
+}
+
+func createFileStorage(path string) (*fileStorage, error) {
+	lock, err := lockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0600)
+	if err != nil {
+		unlockFile(lock)
+		return nil, fmt.Errorf("%w: could not create secure vault file: %v", ErrIO, err)
+	}
+	return &fileStorage{path: path, file: file, lock: lock}, nil
+}
+
+func openFileStorage(path string) (*fileStorage, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("%w: could not open secure vault: %v", ErrIO, err)
+	}
+	lock, err := lockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		unlockFile(lock)
+		return nil, fmt.Errorf("%w: could not open secure vault: %v", ErrIO, err)
+	}
+	return &fileStorage{path: path, file: file, lock: lock}, nil
+}
+
+func (f *fileStorage) ReadAll() ([]byte, error) {
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIO, err)
+	}
+	data, err := io.ReadAll(f.file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIO, err)
+	}
+	return data, nil
+}
+
+func (f *fileStorage) WriteAt(offset int64, data []byte) error {
+	if _, err := f.file.WriteAt(data, offset); err != nil {
+		return fmt.Errorf("%w: %v", ErrIO, err)
+	}
+	return nil
+}
+
+func (f *fileStorage) Truncate(size int64) error {
+	if err := f.file.Truncate(size); err != nil {
+		return fmt.Errorf("%w: could not truncate vault file: %v", ErrIO, err)
+	}
+	return nil
+}
+
+func (f *fileStorage) Sync() error {
+	if err := f.file.Sync(); err != nil {
+		return fmt.Errorf("%w: could not sync vault file: %v", ErrIO, err)
+	}
+	return nil
+}
+
+// Replace writes data to a temporary file that replaces the vault file only
+// after it is fully written and synced, so that a crash midway leaves the
+// vault file as it was.
+func (f *fileStorage) Replace(data []byte) error {
+	temp := f.path + ".rewrite"
+	if err := writeFileSync(temp, data); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	f.file.Close()
+	if err := os.Rename(temp, f.path); err != nil {
+		os.Remove(temp)
+		f.file, _ = os.OpenFile(f.path, os.O_RDWR, 0600)
+		return fmt.Errorf("%w: could not replace vault file: %v", ErrIO, err)
+	}
+	syncDir(filepath.Dir(f.path))
+	file, err := os.OpenFile(f.path, os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("%w: could not reopen vault file: %v", ErrIO, err)
+	}
+	f.file = file
+	return nil
+}
+
+func (f *fileStorage) Close() error {
+	defer unlockFile(f.lock)
+	return f.file.Close()
+}
+
+// memoryStorage keeps the vault in memory only.
+type memoryStorage struct {
+	data []byte
+}
+
+func (m *memoryStorage) ReadAll() ([]byte, error) {
+	return append([]byte{}, m.data...), nil
+}
+
+func (m *memoryStorage) WriteAt(offset int64, data []byte) error {
+	if end := offset + int64(len(data)); end > int64(len(m.data)) {
+		m.data = append(m.data, make([]byte, end-int64(len(m.data)))...)
+	}
+	copy(m.data[offset:], data)
+	return nil
+}
+
+func (m *memoryStorage) Truncate(size int64) error {
+	if size < int64(len(m.data)) {
+		m.data = m.data[:size]
+	}
+	return nil
+}
+
+func (m *memoryStorage) Sync() error {
+	return nil
+}
+
+func (m *memoryStorage) Replace(data []byte) error {
+	m.data = append([]byte{}, data...)
+	return nil
+}
+
+func (m *memoryStorage) Close() error {
+	return nil
+}
+
+// byteStorage keeps the vault on a papirus.ByteStore. The store starts with
+// the offset and size of the vault bytes, as two uint64, which are only
+// updated, in a single write, after the bytes are written. Replace writes the
+// new bytes outside of the current ones and then points the store to them, so
+// that an interrupted Replace leaves the vault as it was. A ByteStore cannot
+// be synced, so durability is up to the store. The store is owned by the
+// caller and is not closed with the vault.
+type byteStorage struct {
+	store papirus.ByteStore
+}
+
+const byteStorageHeader = 16
+
+func newByteStorage(store papirus.ByteStore) *byteStorage {
+	if store.Size() < byteStorageHeader {
+		store.Append(make([]byte, byteStorageHeader-store.Size()))
+	}
+	b := &byteStorage{store: store}
+	if base, _ := b.bounds(); base == 0 {
+		b.setBounds(byteStorageHeader, 0)
+	}
+	return b
+}
+
+func (b *byteStorage) bounds() (int64, int64) {
+	data := b.store.ReadAt(0, byteStorageHeader)
+	base, position := util.ParseUint64(data, 0)
+	size, _ := util.ParseUint64(data, position)
+	return int64(base), int64(size)
+}
+
+func (b *byteStorage) setBounds(base, size int64) {
+	data := make([]byte, 0, byteStorageHeader)
+	util.PutUint64(uint64(base), &data)
+	util.PutUint64(uint64(size), &data)
+	b.store.WriteAt(0, data)
+}
+
+// put writes data at offset of the store, growing it as needed.
+func (b *byteStorage) put(offset int64, data []byte) {
+	if gap := offset - b.store.Size(); gap > 0 {
+		b.store.Append(make([]byte, gap))
+	}
+	if inside := b.store.Size() - offset; inside > 0 {
+		if inside > int64(len(data)) {
+			inside = int64(len(data))
+		}
+		b.store.WriteAt(offset, data[:inside])
+		data = data[inside:]
+	}
+	if len(data) > 0 {
+		b.store.Append(data)
+	}
+}
+
+func (b *byteStorage) ReadAll() ([]byte, error) {
+	base, size := b.bounds()
+	if base < byteStorageHeader || base+size > b.store.Size() {
+		return nil, fmt.Errorf("%w: vault bounds beyond byte store size", ErrIO)
+	}
+	return b.store.ReadAt(base, size), nil
+}
+
+func (b *byteStorage) WriteAt(offset int64, data []byte) error {
+	base, size := b.bounds()
+	b.put(base+offset, data)
+	if end := offset + int64(len(data)); end > size {
+		b.setBounds(base, end)
+	}
+	return nil
+}
+
+func (b *byteStorage) Truncate(size int64) error {
+	if base, current := b.bounds(); size < current {
+		b.setBounds(base, size)
+	}
+	return nil
+}
+
+func (b *byteStorage) Sync() error {
+	return nil
+}
+
+// Replace writes data before the current vault bytes if it fits there, or
+// after every byte of the store otherwise.
+func (b *byteStorage) Replace(data []byte) error {
+	base, size := b.bounds()
+	next := int64(byteStorageHeader)
+	if next+int64(len(data)) > base {
+		next = base + size
+		if end := b.store.Size(); end > next {
+			next = end
+		}
+	}
+	b.put(next, data)
+	b.setBounds(next, int64(len(data)))
+	return nil
+}
+
+func (b *byteStorage) Close() error {
+	return nil
+}
+
+// NewMemoryVault creates a vault with a new random SecretKey that is kept in
+// memory only. Records are sealed and chained as on a vault file, under a
+// random cipher key.
+func NewMemoryVault() (*SecureVault, error) {
+	head, err := newHeader(DefaultKDF)
+	if err != nil {
+		return nil, err
+	}
+	cipherKey := make([]byte, 32)
+	if _, err := rand.Read(cipherKey); err != nil {
+		return nil, fmt.Errorf("could not generate cipher key: %v", err)
+	}
+	_, secret := crypto.RandomAsymetricKey()
+	return createVault(head, cipherKey, &memoryStorage{}, newVaultEntry(secret))
+}
+
+// CreateStoreVault creates a new vault protected by password with a new random
+// SecretKey on store, replacing any vault it held.
+func CreateStoreVault(password []byte, store papirus.ByteStore) (*SecureVault, error) {
+	head, err := newHeader(DefaultKDF)
+	if err != nil {
+		return nil, err
+	}
+	cipherKey, err := head.KDF.Key(password, head.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate cipher key from password and salt: %v", err)
+	}
+	_, secret := crypto.RandomAsymetricKey()
+	return createVault(head, cipherKey, newByteStorage(store), newVaultEntry(secret))
+}
+
+// OpenStoreVault opens the vault on store with password, with the same
+// semantics as OpenSecureVault.
+func OpenStoreVault(password []byte, store papirus.ByteStore) (*SecureVault, error) {
+	return openVault(password, newByteStorage(store), "")
+}
@@ -1,14 +1,15 @@
 package vault
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"errors"
+	"fmt"
 	"io"
 	"log"
-	"os"
+	"path/filepath"
 	"sync"
-
-	"github.com/freehandle/breeze/crypto/scrypt"
-
-	"crypto/rand"
+	"time"
 
 	"github.com/freehandle/breeze/crypto"
 )
@@ -17,6 +18,7 @@ const (
 	TypePrivateKey byte = iota
 	TypeWalletPrivateKey
 	TypeStageSecrets
+	TypeRevocation
 )
 
 type StageSecrets struct {
@@ -30,115 +32,579 @@ type SecureVault struct {
 	mu        sync.Mutex
 	SecretKey crypto.PrivateKey
 	Secrets   map[crypto.Token]crypto.PrivateKey
-	file      io.WriteCloser
+	entries   []*Entry
+	labels    map[string]*Entry
+	stages    []*StageEntry
+	records   [][]byte // plain text of every record in file order
+	path      string   // path of the vault file, empty if not on a file
+	head      *header
+	key       []byte // cipher key derived from passphrase
+	store     storage
 	cipher    crypto.Cipher
+	chainer   []byte // key of the record chain
+	chain     []byte // chain tag of the last record
+	previous  []byte // chain tag of the record before the last one
+	size      int64  // size of the vault file up to its last complete record
+	repaired  bool   // a torn trailing record was removed on open
+	behind    bool   // a tip slot of the vault file is stale, both are written next
 }
 
+// Close closes the vault file and zeroes the keys held in memory. The vault
+// is not usable after it is closed.
 func (s *SecureVault) Close() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.file.Close()
+	if s.store == nil {
+		return
+	}
+	s.store.Close()
+	s.store = nil
+	s.SecretKey = crypto.PrivateKey{}
+	for token := range s.Secrets {
+		s.Secrets[token] = crypto.PrivateKey{}
+	}
+	for _, entry := range s.entries {
+		entry.Key = crypto.PrivateKey{}
+	}
+	for _, stage := range s.stages {
+		zero(stage.Secrets.CipherKey)
+		stage.Secrets = StageSecrets{}
+	}
+	for _, record := range s.records {
+		zero(record)
+	}
+	zero(s.key)
+	zero(s.chainer)
 }
 
-func (vault *SecureVault) GenerateNewKey() (crypto.Token, crypto.PrivateKey) {
+func zero(data []byte) {
+	for n := range data {
+		data[n] = 0
+	}
+}
+
+// Entries returns a copy of every key entry on the vault in the order they
+// were stored. The first entry is always the vault SecretKey.
+func (vault *SecureVault) Entries() []Entry {
 	vault.mu.Lock()
 	defer vault.mu.Unlock()
-	token, newKey := crypto.RandomAsymetricKey()
-	sealed := vault.cipher.Seal(newKey[:])
-	withLen := []byte{byte(len(sealed))}
-	withLen = append(withLen, sealed...)
-	if n, err := vault.file.Write(withLen); n != len(withLen) || err != nil {
-		// TODO: this is serious problem
+	entries := make([]Entry, len(vault.entries))
+	for n, entry := range vault.entries {
+		entries[n] = *entry
+	}
+	return entries
+}
+
+// EntryByLabel returns the entry stored under label.
+func (vault *SecureVault) EntryByLabel(label string) (Entry, bool) {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	if entry, ok := vault.labels[label]; ok {
+		return *entry, true
+	}
+	return Entry{}, false
+}
+
+// KeyByLabel returns the private key stored under label.
+func (vault *SecureVault) KeyByLabel(label string) (crypto.PrivateKey, bool) {
+	entry, ok := vault.EntryByLabel(label)
+	return entry.Key, ok
+}
+
+// EntryByToken returns the entry for the private key associated to token.
+func (vault *SecureVault) EntryByToken(token crypto.Token) (Entry, bool) {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	for _, entry := range vault.entries {
+		if entry.Token() == token {
+			return *entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Deprecated: GenerateNewKey terminates the process if the key cannot be
+// persisted. Use NewKey instead.
+func (vault *SecureVault) GenerateNewKey() (crypto.Token, crypto.PrivateKey) {
+	token, newKey, err := vault.NewKey()
+	if err != nil {
 		log.Fatalf("secret vault is possibly compromissed: %v\n", err)
 	}
-	vault.Secrets[token] = newKey
 	return token, newKey
 }
 
+// NewKey generates a new random unlabeled key and stores it on the vault.
+func (vault *SecureVault) NewKey() (crypto.Token, crypto.PrivateKey, error) {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	token, newKey := crypto.RandomAsymetricKey()
+	if err := vault.appendEntry(&Entry{Type: TypePrivateKey, Created: time.Now(), Key: newKey}); err != nil {
+		return crypto.Token{}, crypto.PrivateKey{}, err
+	}
+	return token, newKey, nil
+}
+
+// GenerateLabeledKey generates a new random key of the given kind (either
+// TypePrivateKey or TypeWalletPrivateKey) and stores it on the vault under a
+// label that must not be already in use.
+func (vault *SecureVault) GenerateLabeledKey(kind byte, label, purpose string) (crypto.Token, crypto.PrivateKey, error) {
+	if kind != TypePrivateKey && kind != TypeWalletPrivateKey {
+		return crypto.Token{}, crypto.PrivateKey{}, errors.New("invalid key type")
+	}
+	if label == "" {
+		return crypto.Token{}, crypto.PrivateKey{}, errors.New("label cannot be empty")
+	}
+	if len(label) > MaxLabelSize || len(purpose) > MaxLabelSize {
+		return crypto.Token{}, crypto.PrivateKey{}, errors.New("label or purpose too long")
+	}
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	if vault.labelInUse(label) {
+		return crypto.Token{}, crypto.PrivateKey{}, errors.New("label already in use")
+	}
+	token, newKey := crypto.RandomAsymetricKey()
+	if err := vault.appendEntry(&Entry{Type: kind, Label: label, Purpose: purpose, Created: time.Now(), Key: newKey}); err != nil {
+		return crypto.Token{}, crypto.PrivateKey{}, err
+	}
+	return token, newKey, nil
+}
+
+// ImportKey stores an existing key on the vault, under label if not empty.
+func (vault *SecureVault) ImportKey(key crypto.PrivateKey, label, purpose string) error {
+	if len(label) > MaxLabelSize || len(purpose) > MaxLabelSize {
+		return errors.New("label or purpose too long")
+	}
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	if vault.hasToken(key.PublicKey()) {
+		return errors.New("key already on vault")
+	}
+	if label != "" && vault.labelInUse(label) {
+		return errors.New("label already in use")
+	}
+	return vault.appendEntry(&Entry{Type: TypePrivateKey, Label: label, Purpose: purpose, Created: time.Now(), Key: key})
+}
+
+func (vault *SecureVault) labelInUse(label string) bool {
+	if _, ok := vault.labels[label]; ok {
+		return true
+	}
+	for _, stage := range vault.stages {
+		if stage.Label == label {
+			return true
+		}
+	}
+	return false
+}
+
+func (vault *SecureVault) hasToken(token crypto.Token) bool {
+	for _, entry := range vault.entries {
+		if entry.Token() == token {
+			return true
+		}
+	}
+	for _, stage := range vault.stages {
+		if stage.Token() == token {
+			return true
+		}
+	}
+	return false
+}
+
+// appendRecord seals data and appends it to the vault file chained to the
+// previous records, then moves the tip to it. The record is synced to disk
+// before appendRecord returns, so a key is never handed out before it is
+// durable. On a failed write the file is truncated back to its last complete
+// record.
+func (vault *SecureVault) appendRecord(data []byte) error {
+	sealed := vault.cipher.Seal(data)
+	tag := chainTag(vault.chainer, vault.chain, sealed)
+	frame := frameRecord(sealed, tag)
+	if err := vault.store.WriteAt(vault.size, frame); err != nil {
+		vault.store.Truncate(vault.size)
+		return err
+	}
+	if err := vault.store.Sync(); err != nil {
+		vault.store.Truncate(vault.size)
+		return err
+	}
+	vault.size += int64(len(frame))
+	vault.previous, vault.chain = vault.chain, tag
+	vault.records = append(vault.records, data)
+	return vault.writeTip()
+}
+
+// writeTip binds the vault file to its current records on the tip slot of
+// their count. If the other slot is stale it is first moved to the previous
+// count, so that a torn write of the new tip always leaves an authentic one.
+func (vault *SecureVault) writeTip() error {
+	offset := int64(len(vault.head.Serialize()))
+	count := uint32(len(vault.records))
+	if vault.behind && count > 0 {
+		slot := offset + int64((count-1)%2)*tipSize
+		if err := vault.writeSync(slot, frameTip(vault.chainer, vault.previous, count-1)); err != nil {
+			return err
+		}
+	}
+	slot := offset + int64(count%2)*tipSize
+	if err := vault.writeSync(slot, frameTip(vault.chainer, vault.chain, count)); err != nil {
+		vault.behind = true
+		return err
+	}
+	vault.behind = false
+	return nil
+}
+
+func (vault *SecureVault) writeSync(offset int64, data []byte) error {
+	if err := vault.store.WriteAt(offset, data); err != nil {
+		return err
+	}
+	return vault.store.Sync()
+}
+
+func (vault *SecureVault) appendEntry(entry *Entry) error {
+	if err := vault.appendRecord(entry.Serialize()); err != nil {
+		return err
+	}
+	vault.incorporate(entry)
+	return nil
+}
+
+func (vault *SecureVault) incorporate(entry *Entry) {
+	vault.entries = append(vault.entries, entry)
+	if entry.Label != "" {
+		vault.labels[entry.Label] = entry
+	}
+	vault.Secrets[entry.Token()] = entry.Key
+}
+
+// revoke removes the key entry or stage secrets identified by token from the
+// vault state.
+func (vault *SecureVault) revoke(token crypto.Token) {
+	for n, stage := range vault.stages {
+		if stage.Token() == token {
+			vault.stages = append(vault.stages[:n], vault.stages[n+1:]...)
+			return
+		}
+	}
+	for n, entry := range vault.entries {
+		if entry.Token() == token {
+			vault.entries = append(vault.entries[:n], vault.entries[n+1:]...)
+			if entry.Label != "" {
+				delete(vault.labels, entry.Label)
+			}
+			delete(vault.Secrets, token)
+			return
+		}
+	}
+}
+
+// Deprecated: NewSecureVault terminates the process on failure. Use
+// CreateSecureVault instead.
 func NewSecureVault(password []byte, fileName string) *SecureVault {
-	file, err := os.Create(fileName)
+	vault, err := CreateSecureVault(password, fileName)
 	if err != nil {
-		log.Fatalf("could not create secure vault file: %v\n", err)
+		log.Fatalf("could not create secure vault: %v\n", err)
+	}
+	return vault
+}
+
+// CreateSecureVault creates a new vault file protected by password with a new
+// random SecretKey.
+func CreateSecureVault(password []byte, fileName string) (*SecureVault, error) {
+	_, secret := crypto.RandomAsymetricKey()
+	return createSecureVault(password, fileName, newVaultEntry(secret))
+}
+
+func newVaultEntry(secret crypto.PrivateKey) *Entry {
+	return &Entry{
+		Type:    TypePrivateKey,
+		Label:   VaultKeyLabel,
+		Purpose: "secure vault secret key",
+		Created: time.Now(),
+		Key:     secret,
 	}
+}
 
-	salt := make([]byte, 32)
-	rand.Read(salt)
-	cipherKey, err := scrypt.Key(password, salt, 32768, 8, 1, 32)
+// createSecureVault creates a new vault file whose first entry, and thus
+// SecretKey, is secret.
+func createSecureVault(password []byte, fileName string, secret *Entry) (*SecureVault, error) {
+	head, err := newHeader(DefaultKDF)
 	if err != nil {
-		log.Fatalf("could not generate cipher key from password and salt: %v\n", err)
+		return nil, err
 	}
-	_, secret := crypto.RandomAsymetricKey()
+	cipherKey, err := head.KDF.Key(password, head.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate cipher key from password and salt: %v", err)
+	}
+	store, err := createFileStorage(fileName)
+	if err != nil {
+		return nil, err
+	}
+	vault, err := createVault(head, cipherKey, store, secret)
+	if err != nil {
+		return nil, err
+	}
+	vault.path = fileName
+	syncDir(filepath.Dir(fileName))
+	return vault, nil
+}
+
+// createVault writes a new vault on store whose first entry, and thus
+// SecretKey, is secret. The store is closed on failure.
+func createVault(head *header, cipherKey []byte, store storage, secret *Entry) (*SecureVault, error) {
 	vault := SecureVault{
-		SecretKey: secret,
+		SecretKey: secret.Key,
 		Secrets:   make(map[crypto.Token]crypto.PrivateKey),
-		file:      file,
+		labels:    make(map[string]*Entry),
+		head:      head,
+		key:       cipherKey,
+		store:     store,
 		cipher:    crypto.CipherFromKey(cipherKey),
+		chainer:   chainKey(cipherKey),
 	}
-	if n, err := file.Write(salt); n != len(salt) || err != nil {
-		log.Fatalf("could not write salto to secure vault file: %v\n", err)
+	data := head.Serialize()
+	vault.chain = chainTag(vault.chainer, nil, data)
+	data = append(data, frameTips(vault.chainer, nil, vault.chain, 0)...)
+	if err := store.Replace(data); err != nil {
+		store.Close()
+		return nil, err
 	}
-	sealed := vault.cipher.Seal(secret[:])
-	if n, err := file.Write(append([]byte{byte(len(sealed))}, sealed...)); n != len(sealed)+1 || err != nil {
-		log.Fatalf("could not write to secure vault file: %v\n", err)
+	vault.size = int64(len(data))
+	if err := vault.appendEntry(secret); err != nil {
+		store.Close()
+		return nil, err
 	}
-	return &vault
+	return &vault, nil
 }
 
+// Deprecated: OpenVaultFromPassword terminates the process on failure. Use
+// OpenSecureVault instead.
 func OpenVaultFromPassword(password []byte, fileName string) *SecureVault {
-	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_RDWR, os.ModeAppend)
+	vault, err := OpenSecureVault(password, fileName)
 	if err != nil {
 		log.Fatalf("Could not open Secret Vault: %v\n", err)
 	}
+	return vault
+}
+
+// OpenSecureVault opens an existing vault file with password. A failure to
+// decrypt the first record is reported as ErrWrongPassphrase, and of any
+// other record, or a broken record chain, as ErrCorruptedRecord. A torn
+// trailing record, shorter than its length says as left by a crash in the
+// middle of a write, is moved to a side file with the .torn suffix and
+// removed from the vault file. Vault files of older versions are migrated to
+// the current version. The vault file is locked until the vault is closed.
+func OpenSecureVault(password []byte, fileName string) (*SecureVault, error) {
+	store, err := openFileStorage(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return openVault(password, store, fileName)
+}
+
+// openVault reads the vault on store, repairs a torn tail and migrates older
+// versions. The store is closed on failure.
+func openVault(password []byte, store storage, path string) (*SecureVault, error) {
+	data, err := store.ReadAll()
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	vault, tail, err := readVault(password, bytes.NewReader(data))
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	vault.path = path
+	vault.store = store
+	if len(tail) > 0 {
+		if err := vault.repair(tail); err != nil {
+			store.Close()
+			return nil, fmt.Errorf("could not repair vault file: %w", err)
+		}
+	}
+	if vault.head.Version == twinTipVersion && vault.behind {
+		if err := vault.writeTip(); err != nil {
+			store.Close()
+			return nil, fmt.Errorf("could not repair vault file: %w", err)
+		}
+	}
+	if vault.head.Version != twinTipVersion {
+		head := *vault.head
+		head.Version = twinTipVersion
+		if err := vault.rewrite(&head, vault.key); err != nil {
+			store.Close()
+			return nil, fmt.Errorf("could not migrate vault file: %w", err)
+		}
+	}
+	return vault, nil
+}
 
+// readVault reads the vault state from file. It also returns the bytes of a
+// torn trailing record, if any: one, other than the first, that ends before
+// its length says. A complete record that cannot be decrypted or does not
+// match the record chain is corrupted, even if it is the last one.
+// A vault whose tips do not authenticate its records as described on the file
+// layout was truncated or tampered with and is reported as ErrCorruptedRecord.
+func readVault(password []byte, file io.Reader) (*SecureVault, []byte, error) {
 	vault := SecureVault{
 		Secrets: make(map[crypto.Token]crypto.PrivateKey),
-		file:    file,
+		labels:  make(map[string]*Entry),
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrIO, err)
+	}
+	reader := bytes.NewReader(data)
+	head, err := readHeader(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := head.KDF.Key(password, head.Salt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not discover cipher key from password and salt: %v", err)
+	}
+	vault.head = head
+	vault.key = key
+	vault.cipher = crypto.CipherFromKey(key)
+	vault.chainer = chainKey(key)
+	vault.chain = chainTag(vault.chainer, nil, head.Serialize())
+	slots := 0
+	if head.Version == tipVersion {
+		slots = 1
+	} else if head.Version == twinTipVersion {
+		slots = 2
+	}
+	counts := make([]uint32, slots)
+	tips := make([][]byte, slots)
+	chains := make([][]byte, slots)
+	for n := range tips {
+		if counts[n], tips[n], err = readTip(reader); err != nil {
+			return nil, nil, err
+		}
 	}
+	vault.size = int64(len(data) - reader.Len())
 
-	salt := make([]byte, 32)
-	if n, err := io.ReadFull(file, salt); n != 32 {
+	var tail []byte
+	for {
+		for n, count := range counts {
+			if uint32(len(vault.records)) == count {
+				chains[n] = vault.chain
+			}
+		}
+		sealed, tag, legacy, err := readRecord(reader, head.Version)
 		if err == io.EOF {
-			log.Fatal("valut file seems corrupted. Could not read private key.")
-		} else {
-			log.Fatalf("valut file seems corrupted. Could not read salt: %v\n", err)
+			break
+		} else if err == ErrTruncatedTail && len(vault.records) > 0 {
+			tail = data[vault.size:]
+			break
+		} else if err != nil {
+			return nil, nil, err
 		}
-	} else {
-		key, err := scrypt.Key(password, salt, 32768, 8, 1, 32)
+		naked, err := vault.cipher.Open(sealed)
 		if err != nil {
-			log.Fatalf("could not discover cipher key from password and salt: %v\n", err)
+			if len(vault.records) == 0 {
+				return nil, nil, ErrWrongPassphrase
+			}
+			return nil, nil, fmt.Errorf("%w: could not decrypt record %v", ErrCorruptedRecord, len(vault.records))
+		}
+		if head.Version >= chainedVersion {
+			expected := chainTag(vault.chainer, vault.chain, sealed)
+			if !hmac.Equal(expected, tag) {
+				return nil, nil, fmt.Errorf("%w: record chain broken at record %v", ErrCorruptedRecord, len(vault.records))
+			}
+			vault.previous, vault.chain = vault.chain, expected
+		}
+		if legacy {
+			entry := &Entry{Type: TypePrivateKey}
+			copy(entry.Key[:], naked)
+			naked = entry.Serialize()
+		}
+		if err := vault.load(naked); err != nil {
+			return nil, nil, fmt.Errorf("%w: record %v: %v", ErrCorruptedRecord, len(vault.records), err)
 		}
-		vault.cipher = crypto.CipherFromKey(key)
+		vault.records = append(vault.records, naked)
+		vault.size = int64(len(data) - reader.Len())
 	}
-
-	first := true // first key is the private key for the wallet app itself.
-	size := make([]byte, 1)
-	for {
-		if n, err := io.ReadFull(file, size); n == 1 {
-			keyBytes := make([]byte, int(size[0]))
-			if n, err := io.ReadFull(file, keyBytes); n == int(size[0]) {
-				if naked, err := vault.cipher.Open(keyBytes); err != nil {
-					log.Fatalf("could not decrypt key: %v\n", err)
-				} else {
-					var key crypto.PrivateKey
-					copy(key[:], naked)
-					if first {
-						vault.SecretKey = key
-						first = false
-					}
-					vault.Secrets[key.PublicKey()] = key
+	if len(vault.entries) == 0 {
+		return nil, nil, fmt.Errorf("%w: vault has no secret key", ErrCorruptedRecord)
+	}
+	if slots > 0 {
+		authentic := 0
+		var newest uint32
+		for n, count := range counts {
+			if chains[n] != nil && hmac.Equal(tipTag(vault.chainer, chains[n], count), tips[n]) {
+				authentic++
+				if count > newest {
+					newest = count
 				}
-			} else {
-				log.Fatalf("could not parse key: %v, %v\n", err, size[0])
-			}
-			if err == io.EOF {
-				break
-			}
-		} else {
-			if err == io.EOF {
-				break
 			}
 		}
+		if authentic == 0 {
+			return nil, nil, fmt.Errorf("%w: vault tip does not match its records", ErrCorruptedRecord)
+		}
+		// a stale slot is only left by a tip write that followed a record
+		if authentic < slots && uint32(len(vault.records)) <= newest {
+			return nil, nil, fmt.Errorf("%w: vault ends at record %v of its tip", ErrCorruptedRecord, len(vault.records))
+		}
+		vault.behind = authentic < slots || uint32(len(vault.records)) > newest
+	}
+	return &vault, tail, nil
+}
+
+// repair truncates the vault to its last complete record. A torn trailing
+// record of a vault file is kept on a side file.
+func (vault *SecureVault) repair(tail []byte) error {
+	if vault.path != "" {
+		if err := writeFileSync(vault.path+".torn", tail); err != nil {
+			return err
+		}
+	}
+	if err := vault.store.Truncate(vault.size); err != nil {
+		return err
+	}
+	if err := vault.store.Sync(); err != nil {
+		return err
+	}
+	vault.repaired = true
+	return nil
+}
+
+// Repaired reports whether a torn trailing record was removed from the vault
+// file when it was opened.
+func (vault *SecureVault) Repaired() bool {
+	return vault.repaired
+}
 
+// load incorporates the plain text of a record into the vault state.
+func (vault *SecureVault) load(naked []byte) error {
+	if len(naked) == 0 {
+		return errors.New("empty record")
+	}
+	switch naked[0] {
+	case TypeStageSecrets:
+		stage := ParseStageEntry(naked)
+		if stage == nil {
+			return errors.New("could not parse stage secrets")
+		}
+		vault.stages = append(vault.stages, stage)
+	case TypeRevocation:
+		revoked := parseRevocation(naked)
+		if revoked == nil {
+			return errors.New("could not parse revocation")
+		}
+		vault.revoke(revoked.Token)
+	default:
+		entry := ParseEntry(naked)
+		if entry == nil {
+			return errors.New("could not parse entry")
+		}
+		if len(vault.entries) == 0 {
+			// first key is the private key for the wallet app itself.
+			vault.SecretKey = entry.Key
+		}
+		vault.incorporate(entry)
 	}
-	return &vault
+	return nil
 }
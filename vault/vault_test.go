@@ -0,0 +1,675 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/papirus"
+)
+
+var testPassword = []byte("correct horse battery staple")
+
+func newTestVault(t *testing.T) (*SecureVault, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "vault.dat")
+	vault, err := CreateSecureVault(testPassword, path)
+	if err != nil {
+		t.Fatalf("could not create vault: %v", err)
+	}
+	return vault, path
+}
+
+// recordOffsets returns the offset of every record of a version 4 vault file
+// followed by the file size.
+func recordOffsets(t *testing.T, data []byte) []int {
+	t.Helper()
+	offset := len(headerMagic) + 1 + 12 + saltSize + 2*tipSize
+	offsets := []int{offset}
+	for offset < len(data) {
+		offset += 2 + (int(data[offset]) | int(data[offset+1])<<8) + tagSize
+		offsets = append(offsets, offset)
+	}
+	if offset != len(data) {
+		t.Fatalf("vault file does not end on a record boundary")
+	}
+	return offsets
+}
+
+func readTestFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	vault, path := newTestVault(t)
+	token, key, err := vault.GenerateLabeledKey(TypePrivateKey, "node", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := vault.SecretKey
+	vault.Close()
+
+	vault, err = OpenSecureVault(testPassword, path)
+	if err != nil {
+		t.Fatalf("could not reopen vault: %v", err)
+	}
+	defer vault.Close()
+	if vault.SecretKey != secret {
+		t.Error("secret key changed on reopen")
+	}
+	if got, ok := vault.KeyByLabel("node"); !ok || got != key {
+		t.Error("labeled key not found on reopen")
+	}
+	if vault.Secrets[token] != key {
+		t.Error("key not on secrets after reopen")
+	}
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	vault, path := newTestVault(t)
+	vault.Close()
+	if _, err := OpenSecureVault([]byte("wrong"), path); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("expected ErrWrongPassphrase, got %v", err)
+	}
+}
+
+func TestUnsupportedHeader(t *testing.T) {
+	vault, path := newTestVault(t)
+	vault.Close()
+	data := readTestFile(t, path)
+	version := len(headerMagic)
+	tests := []struct {
+		name   string
+		tamper func([]byte)
+		want   error
+	}{
+		{"newer version", func(d []byte) { d[version] = twinTipVersion + 1 }, ErrUnsupportedVersion},
+		{"huge N", func(d []byte) { copy(d[version+1:], []byte{0xff, 0xff, 0xff, 0x7f}) }, ErrCorruptedRecord},
+		{"zero r", func(d []byte) { copy(d[version+5:], []byte{0, 0, 0, 0}) }, ErrCorruptedRecord},
+		{"huge p", func(d []byte) { copy(d[version+9:], []byte{0xff, 0xff, 0xff, 0x7f}) }, ErrCorruptedRecord},
+	}
+	for _, test := range tests {
+		tampered := append([]byte{}, data...)
+		test.tamper(tampered)
+		writeTestFile(t, path, tampered)
+		vault, err := OpenSecureVault(testPassword, path)
+		if !errors.Is(err, test.want) {
+			t.Errorf("%v: expected %v, got %v", test.name, test.want, err)
+		}
+		if err == nil {
+			vault.Close()
+		}
+	}
+}
+
+func TestBundleKDFBounds(t *testing.T) {
+	vault, _ := newTestVault(t)
+	defer vault.Close()
+	bundle, err := vault.ExportBundle(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(bundle[len(bundleMagic):], []byte{0xff, 0xff, 0xff, 0x7f})
+	if _, err := vault.ImportBundle(bundle, testPassword); err == nil {
+		t.Fatal("bundle with huge scrypt N accepted")
+	}
+}
+
+func TestCloseZeroesKeys(t *testing.T) {
+	vault, _ := newTestVault(t)
+	token, _, err := vault.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault.Close()
+	vault.Close()
+	if vault.SecretKey != (crypto.PrivateKey{}) || vault.Secrets[token] != (crypto.PrivateKey{}) {
+		t.Error("keys kept in memory after close")
+	}
+}
+
+func TestLocked(t *testing.T) {
+	vault, path := newTestVault(t)
+	if _, err := OpenSecureVault(testPassword, path); err == nil {
+		t.Fatal("vault opened twice")
+	}
+	vault.Close()
+	vault, err := OpenSecureVault(testPassword, path)
+	if err != nil {
+		t.Fatalf("could not open vault after close: %v", err)
+	}
+	vault.Close()
+}
+
+func TestTamperedRecord(t *testing.T) {
+	vault, path := newTestVault(t)
+	if _, _, err := vault.NewKey(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := vault.NewKey(); err != nil {
+		t.Fatal(err)
+	}
+	vault.Close()
+	data := readTestFile(t, path)
+	offsets := recordOffsets(t, data)
+	for n := 1; n < len(offsets)-1; n++ {
+		tampered := append([]byte{}, data...)
+		tampered[offsets[n]+10] ^= 0x01
+		writeTestFile(t, path, tampered)
+		if _, err := OpenSecureVault(testPassword, path); !errors.Is(err, ErrCorruptedRecord) {
+			t.Errorf("record %v: expected ErrCorruptedRecord, got %v", n, err)
+		}
+	}
+}
+
+func TestTamperedTrailingTombstone(t *testing.T) {
+	vault, path := newTestVault(t)
+	token, _, err := vault.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.RevokeKey(token); err != nil {
+		t.Fatal(err)
+	}
+	vault.Close()
+	data := readTestFile(t, path)
+	offsets := recordOffsets(t, data)
+	data[offsets[len(offsets)-2]+10] ^= 0x01
+	writeTestFile(t, path, data)
+	if _, err := OpenSecureVault(testPassword, path); !errors.Is(err, ErrCorruptedRecord) {
+		t.Fatalf("expected ErrCorruptedRecord, got %v", err)
+	}
+}
+
+func TestTruncatedTail(t *testing.T) {
+	vault, path := newTestVault(t)
+	kept, _, err := vault.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a record written after the tip was last moved and torn by a crash
+	_, key := crypto.RandomAsymetricKey()
+	sealed := crypto.CipherFromKey(vault.key).Seal((&Entry{Type: TypePrivateKey, Key: key}).Serialize())
+	torn := frameRecord(sealed, chainTag(vault.chainer, vault.chain, sealed))
+	vault.Close()
+	data := readTestFile(t, path)
+	offsets := recordOffsets(t, data)
+	writeTestFile(t, path, append(data, torn[:len(torn)/2]...))
+
+	vault, err = OpenSecureVault(testPassword, path)
+	if err != nil {
+		t.Fatalf("could not open vault with torn tail: %v", err)
+	}
+	defer vault.Close()
+	if !vault.Repaired() {
+		t.Error("torn tail not reported")
+	}
+	if _, ok := vault.Secrets[kept]; !ok {
+		t.Error("complete record lost on repair")
+	}
+	if len(readTestFile(t, path)) != offsets[len(offsets)-1] {
+		t.Error("vault file not truncated to its last complete record")
+	}
+	if _, err := os.Stat(path + ".torn"); err != nil {
+		t.Errorf("torn record not kept on side file: %v", err)
+	}
+}
+
+func TestDroppedTrailingRecord(t *testing.T) {
+	vault, path := newTestVault(t)
+	token, _, err := vault.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.RevokeKey(token); err != nil {
+		t.Fatal(err)
+	}
+	vault.Close()
+	data := readTestFile(t, path)
+	offsets := recordOffsets(t, data)
+	writeTestFile(t, path, data[:offsets[len(offsets)-2]])
+	if _, err := OpenSecureVault(testPassword, path); !errors.Is(err, ErrCorruptedRecord) {
+		t.Fatalf("expected ErrCorruptedRecord, got %v", err)
+	}
+}
+
+func TestTornTip(t *testing.T) {
+	vault, path := newTestVault(t)
+	token, _, err := vault.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault.Close()
+	data := readTestFile(t, path)
+	offsets := recordOffsets(t, data)
+	count := len(offsets) - 1
+	tips := len(headerMagic) + 1 + 12 + saltSize
+	newest := tips + (count%2)*tipSize
+	tests := []struct {
+		name   string
+		tamper func([]byte) []byte
+		opens  bool
+	}{
+		{"torn newest tip", func(d []byte) []byte {
+			copy(d[newest+tipSize/2:newest+tipSize], make([]byte, tipSize/2))
+			return d
+		}, true},
+		{"garbled newest tip", func(d []byte) []byte {
+			for n := newest; n < newest+tipSize; n++ {
+				d[n] ^= 0xa5
+			}
+			return d
+		}, true},
+		{"both tips garbled", func(d []byte) []byte {
+			for n := tips; n < tips+2*tipSize; n++ {
+				d[n] ^= 0xa5
+			}
+			return d
+		}, false},
+		{"newest tip garbled and last record dropped", func(d []byte) []byte {
+			d[newest] ^= 0xa5
+			return d[:offsets[count-1]]
+		}, false},
+	}
+	for _, test := range tests {
+		writeTestFile(t, path, test.tamper(append([]byte{}, data...)))
+		vault, err := OpenSecureVault(testPassword, path)
+		if !test.opens {
+			if !errors.Is(err, ErrCorruptedRecord) {
+				t.Errorf("%v: expected ErrCorruptedRecord, got %v", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: could not reopen vault: %v", test.name, err)
+			continue
+		}
+		if _, ok := vault.Secrets[token]; !ok {
+			t.Errorf("%v: key lost on reopen", test.name)
+		}
+		vault.Close()
+		// the tip is repaired on open, and a later append is still accepted
+		vault, err = OpenSecureVault(testPassword, path)
+		if err != nil {
+			t.Errorf("%v: could not reopen repaired vault: %v", test.name, err)
+			continue
+		}
+		if _, _, err := vault.NewKey(); err != nil {
+			t.Errorf("%v: %v", test.name, err)
+		}
+		vault.Close()
+		if vault, err = OpenSecureVault(testPassword, path); err != nil {
+			t.Errorf("%v: could not reopen vault after append: %v", test.name, err)
+			continue
+		}
+		vault.Close()
+	}
+}
+
+func TestRevokeThenCompact(t *testing.T) {
+	vault, path := newTestVault(t)
+	_, key := crypto.RandomAsymetricKey()
+	token := key.PublicKey()
+	if err := vault.ImportKey(key, "imported", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.RevokeKey(token); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := vault.EntryByToken(token); ok {
+		t.Fatal("revoked key still on vault")
+	}
+	if err := vault.ImportKey(key, "imported", "test"); err != nil {
+		t.Fatalf("could not import revoked key again: %v", err)
+	}
+	revoked, _, err := vault.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.RevokeKey(revoked); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Compact(); err != nil {
+		t.Fatalf("could not compact vault: %v", err)
+	}
+	vault.Close()
+
+	vault, err = OpenSecureVault(testPassword, path)
+	if err != nil {
+		t.Fatalf("could not reopen compacted vault: %v", err)
+	}
+	defer vault.Close()
+	if n := len(vault.records); n != 2 {
+		t.Errorf("expected 2 records after compact, got %v", n)
+	}
+	if n := len(vault.Entries()); n != 2 {
+		t.Errorf("expected 2 entries after compact, got %v", n)
+	}
+	if entry, ok := vault.EntryByLabel("imported"); !ok || entry.Key != key {
+		t.Error("re-imported key lost on compact")
+	}
+	if _, ok := vault.Secrets[revoked]; ok {
+		t.Error("revoked key back after compact")
+	}
+}
+
+func TestStoreVaultRekey(t *testing.T) {
+	store := papirus.NewMemoryStore(1 << 16)
+	vault, err := CreateStoreVault(testPassword, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := vault.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < 3; n++ {
+		if err := vault.Rekey([]byte("new password"), nil); err != nil {
+			t.Fatalf("could not rekey: %v", err)
+		}
+		if _, _, err := vault.NewKey(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := OpenStoreVault(testPassword, store); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("expected ErrWrongPassphrase with old password, got %v", err)
+	}
+	vault, err = OpenStoreVault([]byte("new password"), store)
+	if err != nil {
+		t.Fatalf("could not reopen rekeyed vault: %v", err)
+	}
+	if _, ok := vault.Secrets[token]; !ok {
+		t.Error("key lost on rekey")
+	}
+	if n := len(vault.Entries()); n != 5 {
+		t.Errorf("expected 5 entries, got %v", n)
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	vault, path := newTestVault(t)
+	first, err := vault.DeriveKey("axe/validator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault.Close()
+	vault, err = OpenSecureVault(testPassword, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vault.Close()
+	tests := []struct {
+		path string
+		same bool
+	}{
+		{"axe/validator", true},
+		{"axe/validator/0", false},
+		{"axe/relay", false},
+		{"validator/axe", false},
+	}
+	for _, test := range tests {
+		key, err := vault.DeriveKey(test.path)
+		if err != nil {
+			t.Fatalf("%v: %v", test.path, err)
+		}
+		if (key == first) != test.same {
+			t.Errorf("%v: same key as axe/validator is %v", test.path, key == first)
+		}
+		if key == vault.SecretKey {
+			t.Errorf("%v: derived key is the secret key", test.path)
+		}
+	}
+	for _, path := range []string{"", "axe//validator", "axe/"} {
+		if _, err := vault.DeriveKey(path); err == nil {
+			t.Errorf("invalid path %q accepted", path)
+		}
+	}
+}
+
+func TestStageSecrets(t *testing.T) {
+	vault, path := newTestVault(t)
+	stages := []struct {
+		label   string
+		purpose string
+		revoke  bool
+	}{
+		{"forum", "stage of the forum", false},
+		{"closed", "revoked stage", true},
+		{"blog", "", false},
+	}
+	secrets := make([]StageSecrets, len(stages))
+	for n, stage := range stages {
+		created, err := vault.NewStageSecrets(stage.label, stage.purpose)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secrets[n] = *created
+		secrets[n].CipherKey = append([]byte{}, created.CipherKey...)
+	}
+	if _, err := vault.NewStageSecrets("forum", "again"); err == nil {
+		t.Error("stage label reused")
+	}
+	for n, stage := range stages {
+		if stage.revoke {
+			if err := vault.RevokeStageSecrets(secrets[n].Ownership.PublicKey()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	check := func(when string) {
+		t.Helper()
+		if len(vault.StageEntries()) != 2 {
+			t.Errorf("%v: %v stage entries", when, len(vault.StageEntries()))
+		}
+		for n, stage := range stages {
+			byLabel, okLabel := vault.StageSecretsByLabel(stage.label)
+			byToken, okToken := vault.StageSecretsByToken(secrets[n].Ownership.PublicKey())
+			if stage.revoke {
+				if okLabel || okToken {
+					t.Errorf("%v: revoked stage %v returned", when, stage.label)
+				}
+				continue
+			}
+			if !okLabel || !okToken {
+				t.Errorf("%v: stage %v not found", when, stage.label)
+				continue
+			}
+			for _, got := range []*StageSecrets{byLabel, byToken} {
+				if got.Ownership != secrets[n].Ownership || got.Moderation != secrets[n].Moderation ||
+					got.Submission != secrets[n].Submission || !bytes.Equal(got.CipherKey, secrets[n].CipherKey) {
+					t.Errorf("%v: stage %v secrets changed", when, stage.label)
+				}
+			}
+		}
+	}
+	check("before reopen")
+	vault.Close()
+	var err error
+	if vault, err = OpenSecureVault(testPassword, path); err != nil {
+		t.Fatal(err)
+	}
+	check("after reopen")
+	if err := vault.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	check("after compact")
+	vault.Close()
+	if vault, err = OpenSecureVault(testPassword, path); err != nil {
+		t.Fatal(err)
+	}
+	defer vault.Close()
+	check("after compact and reopen")
+}
+
+func TestFileVaultRekey(t *testing.T) {
+	tests := []struct {
+		name string
+		kdf  *KDFParams
+		want KDFParams
+	}{
+		{"same parameters", nil, DefaultKDF},
+		{"cheaper", &KDFParams{N: 1024, R: 8, P: 1}, KDFParams{N: 1024, R: 8, P: 1}},
+		{"costlier", &KDFParams{N: 1 << 16, R: 8, P: 2}, KDFParams{N: 1 << 16, R: 8, P: 2}},
+	}
+	for _, test := range tests {
+		vault, path := newTestVault(t)
+		token, _, err := vault.NewKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vault.Rekey([]byte("new password"), &KDFParams{N: 1000, R: 8, P: 1}); err == nil {
+			t.Errorf("%v: rekey with invalid parameters accepted", test.name)
+		}
+		newPassword := []byte("new password " + test.name)
+		if err := vault.Rekey(newPassword, test.kdf); err != nil {
+			t.Fatalf("%v: could not rekey: %v", test.name, err)
+		}
+		vault.Close()
+		if _, err := OpenSecureVault(testPassword, path); !errors.Is(err, ErrWrongPassphrase) {
+			t.Errorf("%v: expected ErrWrongPassphrase with old passphrase, got %v", test.name, err)
+		}
+		vault, err = OpenSecureVault(newPassword, path)
+		if err != nil {
+			t.Fatalf("%v: could not reopen rekeyed vault: %v", test.name, err)
+		}
+		if vault.head.KDF != test.want {
+			t.Errorf("%v: vault reopened with %+v", test.name, vault.head.KDF)
+		}
+		if _, ok := vault.Secrets[token]; !ok {
+			t.Errorf("%v: key lost on rekey", test.name)
+		}
+		vault.Close()
+	}
+}
+
+func TestBundleAndMnemonic(t *testing.T) {
+	source, _ := newTestVault(t)
+	defer source.Close()
+	labeled, key, err := source.GenerateLabeledKey(TypePrivateKey, "node", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, _, err := source.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := source.RevokeKey(revoked); err != nil {
+		t.Fatal(err)
+	}
+	stage, err := source.NewStageSecrets("forum", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exportPassword := []byte("export passphrase")
+	bundle, err := source.ExportBundle(exportPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+
+	t.Run("wrong export passphrase", func(t *testing.T) {
+		target, _ := newTestVault(t)
+		defer target.Close()
+		if _, err := target.ImportBundle(bundle, []byte("wrong")); !errors.Is(err, ErrWrongPassphrase) {
+			t.Errorf("import: expected ErrWrongPassphrase, got %v", err)
+		}
+		path := filepath.Join(dir, "wrong.dat")
+		if _, err := RestoreBundle(bundle, []byte("wrong"), testPassword, path); !errors.Is(err, ErrWrongPassphrase) {
+			t.Errorf("restore: expected ErrWrongPassphrase, got %v", err)
+		}
+		if _, err := os.Stat(path); err == nil {
+			t.Error("vault file created from a bundle that could not be opened")
+		}
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		path := filepath.Join(dir, "restored.dat")
+		restored, err := RestoreBundle(bundle, exportPassword, testPassword, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		restored.Close()
+		if restored, err = OpenSecureVault(testPassword, path); err != nil {
+			t.Fatal(err)
+		}
+		defer restored.Close()
+		if restored.SecretKey != source.SecretKey {
+			t.Error("secret key not restored")
+		}
+		if got, ok := restored.KeyByLabel("node"); !ok || got != key {
+			t.Error("labeled key not restored")
+		}
+		if _, ok := restored.EntryByToken(revoked); ok {
+			t.Error("revoked key restored")
+		}
+		if got, ok := restored.StageSecretsByLabel("forum"); !ok || got.Ownership != stage.Ownership {
+			t.Error("stage secrets not restored")
+		}
+	})
+
+	t.Run("import", func(t *testing.T) {
+		target, _ := newTestVault(t)
+		defer target.Close()
+		imported, err := target.ImportBundle(bundle, exportPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if imported != 3 {
+			t.Errorf("expected 3 imported records, got %v", imported)
+		}
+		if target.SecretKey == source.SecretKey {
+			t.Error("import replaced the secret key of the vault")
+		}
+		if entry, ok := target.EntryByToken(source.SecretKey.PublicKey()); !ok || entry.Label != "" {
+			t.Error("exporting secret key not imported as an unlabeled key")
+		}
+		if _, ok := target.EntryByToken(labeled); !ok {
+			t.Error("labeled key not imported")
+		}
+		if _, ok := target.StageSecretsByLabel("forum"); !ok {
+			t.Error("stage secrets not imported")
+		}
+		if imported, err := target.ImportBundle(bundle, exportPassword); err != nil || imported != 0 {
+			t.Errorf("second import returned %v, %v", imported, err)
+		}
+	})
+
+	t.Run("mnemonic", func(t *testing.T) {
+		phrase := source.Mnemonic()
+		recovered, err := RecoverSecureVault(testPassword, filepath.Join(dir, "recovered.dat"), phrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer recovered.Close()
+		if recovered.SecretKey != source.SecretKey {
+			t.Error("secret key not recovered from mnemonic")
+		}
+		want, _ := source.DeriveKey("axe/validator")
+		if got, _ := recovered.DeriveKey("axe/validator"); got != want {
+			t.Error("derived key differs on recovered vault")
+		}
+		words := strings.Fields(phrase)
+		words[0], words[1] = words[1], words[0]
+		if words[0] != words[1] {
+			if _, err := KeyFromMnemonic(strings.Join(words, " ")); err == nil {
+				t.Error("mnemonic with swapped words accepted")
+			}
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package vault
+
+// wordlist holds the 256 words of mnemonic phrases. The n-th word encodes the
+// byte value n. It must never be changed, otherwise printed phrases could no
+// longer be recovered.
+var wordlist = [256]string{
+	"able", "acid", "aged", "also", "area", "army", "away", "baby",
+	"back", "ball", "band", "bank", "base", "bath", "bear", "beat",
+	"bell", "belt", "best", "bird", "blow", "blue", "boat", "body",
+	"bold", "bone", "book", "boot", "born", "boss", "both", "bowl",
+	"bulk", "burn", "bush", "busy", "cafe", "cage", "cake", "call",
+	"calm", "camp", "card", "care", "cart", "case", "cash", "cast",
+	"cell", "chef", "chip", "city", "clay", "club", "coal", "coat",
+	"code", "cold", "cook", "cool", "copy", "corn", "cost", "crew",
+	"crop", "dark", "data", "date", "dawn", "deal", "deck", "deep",
+	"deer", "desk", "dial", "diet", "dirt", "dish", "dock", "door",
+	"dose", "down", "draw", "drop", "drum", "duck", "dust", "duty",
+	"earn", "ease", "east", "easy", "edge", "else", "even", "exit",
+	"face", "fact", "fair", "fall", "farm", "fast", "fear", "feed",
+	"feel", "file", "film", "find", "fine", "fire", "firm", "fish",
+	"five", "flag", "flat", "flow", "foam", "fold", "folk", "food",
+	"foot", "fork", "form", "fort", "four", "free", "frog", "fuel",
+	"full", "fund", "gain", "game", "gate", "gear", "gift", "girl",
+	"glad", "glow", "goal", "gold", "golf", "good", "gray", "grid",
+	"grow", "gulf", "hair", "half", "hall", "hand", "hang", "hard",
+	"harm", "hawk", "head", "heat", "help", "herb", "hero", "high",
+	"hill", "hint", "hold", "hole", "home", "hood", "hook", "hope",
+	"horn", "host", "hour", "huge", "hunt", "idea", "inch", "iron",
+	"item", "jazz", "join", "joke", "jump", "jury", "keen", "keep",
+	"kick", "kind", "king", "kite", "knee", "knot", "lady", "lake",
+	"lamp", "land", "lane", "last", "late", "lawn", "lead", "leaf",
+	"lens", "life", "lift", "lime", "line", "link", "lion", "list",
+	"live", "load", "loan", "lock", "long", "loop", "lord", "loud",
+	"love", "luck", "lung", "mail", "main", "make", "male", "mall",
+	"many", "map", "mark", "mask", "mass", "meal", "meat", "menu",
+	"mild", "milk", "mill", "mind", "mint", "miss", "mode", "moon",
+	"more", "most", "move", "much", "nail", "name", "navy", "near",
+	"neck", "need", "nest", "news", "next", "nice", "note", "oath",
+}